@@ -1,71 +1,485 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/xml"
 	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/lockout"
+	"webapp/pkg/repository"
+	"webapp/pkg/validator"
+	"webapp/pkg/verification"
 
+	"github.com/go-chi/chi/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Credentials struct {
-	Username string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"email" xml:"email"`
+	Password string `json:"password" xml:"password"`
 }
 
 func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 	var creds Credentials
 	// read a json payload
-	err := app.readJSON(w, r, &creds)
-	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+	err := app.readRequest(w, r, &creds)
+	if errors.Is(err, errUnsupportedMediaType) {
+		app.errorJSON(w, r, err)
+		return
+	} else if err != nil {
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	ip := app.clientIP(r)
+
+	// don't even check the password while the account or ip is locked
+	if _, err := app.Lockout.Check(creds.Username, ip); err != nil {
+		if !errors.Is(err, lockout.ErrLocked) {
+			log.Println(err)
+		}
+		app.errorJSON(w, r, errUnauthorized)
 		return
 	}
 
 	// look up the user by email address
 	user, err := app.DB.GetUserByEmail(creds.Username)
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		app.loginFailed(creds.Username, ip)
+		app.errorJSON(w, r, errUnauthorized)
 		return
 	}
 
 	// check password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		app.loginFailed(creds.Username, ip)
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	if err := app.Lockout.Succeed(creds.Username); err != nil {
+		log.Println(err)
+	}
+
+	// no tokens until the email address is confirmed through the web app
+	if !user.EmailVerified() {
+		app.errorJSON(w, r, errEmailNotVerified)
 		return
 	}
 
 	// generate tokens
 	tokenPairs, err := app.generateTokenPair(user)
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		app.errorJSON(w, r, errUnauthorized)
 		return
 	}
 
 	// send tokens to user
-	_ = app.writeJSON(w, http.StatusOK, tokenPairs)
+	_ = app.writeResponse(w, r, http.StatusOK, tokenPairs)
+}
+
+// loginFailed counts a failed login against the account and the ip.
+func (app *application) loginFailed(email, ip string) {
+	if err := app.Lockout.Fail(email, ip); err != nil {
+		log.Println(err)
+	}
+}
+
+type refreshPayload struct {
+	RefreshToken string `json:"refresh_token" xml:"refresh_token"`
 }
 
 func (app *application) refresh(w http.ResponseWriter, r *http.Request) {
+	var payload refreshPayload
+	err := app.readRequest(w, r, &payload)
+	if errors.Is(err, errUnsupportedMediaType) {
+		app.errorJSON(w, r, err)
+		return
+	} else if err != nil {
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	// verify signature, expiry and issuer of the refresh token
+	claims, err := app.parseToken(payload.RefreshToken)
+	if err != nil {
+		app.errorJSON(w, r, tokenError(err))
+		return
+	}
+
+	if claims.TokenType != refreshTokenType {
+		app.errorJSON(w, r, errInvalidToken)
+		return
+	}
+
+	// look up the stored token
+	stored, err := app.DB.GetRefreshToken(hashToken(payload.RefreshToken))
+	if err != nil || claims.Subject != strconv.Itoa(stored.UserID) || time.Now().After(stored.ExpiresAt) {
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	// mark the token as used; if it was used before, someone is replaying it,
+	// so we revoke the whole family
+	fresh, err := app.DB.UseRefreshToken(stored.ID)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
 
+	if !fresh {
+		if stored.RevokedAt.IsZero() {
+			log.Printf("refresh token reuse detected for user %d, revoking family %s", stored.UserID, stored.FamilyID)
+		}
+
+		err = app.DB.RevokeRefreshTokenFamily(stored.FamilyID)
+		if err != nil {
+			app.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUser(stored.UserID)
+	if err != nil {
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	// the email address was changed since the family was issued
+	if !user.EmailVerified() {
+		if err := app.DB.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+			log.Println(err)
+		}
+		app.errorJSON(w, r, errEmailNotVerified)
+		return
+	}
+
+	// issue a new pair in the same family
+	tokenPairs, err := app.generateTokenPairInFamily(user, stored.FamilyID)
+	if err != nil {
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	_ = app.writeResponse(w, r, http.StatusOK, tokenPairs)
+}
+
+// logout revokes the access token used for the request, and every refresh token
+// issued together with it.
+func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.identityFromContext(r.Context())
+	if !ok {
+		app.errorJSON(w, r, errUnauthorized)
+		return
+	}
+
+	err := app.Denylist.Revoke(id.TokenID, id.TokenExpiry)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if id.SessionID != "" {
+		err = app.DB.RevokeRefreshTokenFamily(id.SessionID)
+		if err != nil {
+			app.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type listMetadata struct {
+	Total      int    `json:"total" xml:"total"`
+	Limit      int    `json:"limit" xml:"limit"`
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+}
+
+type userList struct {
+	XMLName  xml.Name     `json:"-" xml:"user_list"`
+	Users    []*data.User `json:"users" xml:"users>user"`
+	Metadata listMetadata `json:"metadata" xml:"metadata"`
+}
+
+// items makes the users of the page a collection, which can be sent as csv.
+func (l userList) items() any {
+	return l.Users
 }
 
+// allUsers lists users one page at a time. It understands the query parameters
+// limit, cursor, sort (prefix the field with - to sort descending), is_admin,
+// created_after and created_before.
 func (app *application) allUsers(w http.ResponseWriter, r *http.Request) {
+	opts, fields := listOptionsFromQuery(r.URL.Query(), printer(r))
+	if len(fields) > 0 {
+		app.validationErrorJSON(w, r, fields)
+		return
+	}
+
+	page, err := app.DB.ListUsers(opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			app.validationErrorJSON(w, r, validator.Errors{"cursor": {printer(r).Sprintf("cursor is not valid")}})
+			return
+		}
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	users := page.Users
+	if users == nil {
+		users = []*data.User{}
+	}
+
+	_ = app.writeResponse(w, r, http.StatusOK, userList{
+		Users: users,
+		Metadata: listMetadata{
+			Total:      page.Total,
+			Limit:      page.Limit,
+			NextCursor: page.NextCursor,
+		},
+	})
+}
+
+// searchUsers finds users by partial name or email, best matches first.
+func (app *application) searchUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len([]rune(query)) < 2 {
+		app.validationErrorJSON(w, r, validator.Errors{"q": {printer(r).Sprintf("search query must be at least 2 characters long")}})
+		return
+	}
+
+	limit := repository.DefaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > repository.MaxListLimit {
+			app.validationErrorJSON(w, r, validator.Errors{"limit": {printer(r).Sprintf("limit must be a number between 1 and 100")}})
+			return
+		}
+		limit = l
+	}
+
+	users, err := app.DB.SearchUsers(query, limit)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if users == nil {
+		users = []*data.User{}
+	}
 
+	_ = app.writeResponse(w, r, http.StatusOK, users, "users")
 }
 
 func (app *application) getUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		app.errorJSON(w, r, errInvalidUserID)
+		return
+	}
 
+	user, err := app.DB.GetUser(userID)
+	if err != nil {
+		app.userLookupError(w, r, err)
+		return
+	}
+
+	_ = app.writeResponse(w, r, http.StatusOK, user)
 }
 
 func (app *application) updateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		app.errorJSON(w, r, errInvalidUserID)
+		return
+	}
+
+	var payload userPatch
+	err = app.readRequest(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	// validate the fields that were sent
+	if fields := validate(r, payload); fields != nil {
+		app.validationErrorJSON(w, r, fields)
+		return
+	}
+
+	// only admins can grant or take away admin rights
+	if id, ok := app.identityFromContext(r.Context()); payload.IsAdmin != nil && (!ok || !id.IsAdmin()) {
+		app.errorJSON(w, r, errForbidden)
+		return
+	}
+
+	user, err := app.DB.GetUser(userID)
+	if err != nil {
+		app.userLookupError(w, r, err)
+		return
+	}
+
+	// make sure a changed email is not taken by someone else
+	if payload.Email != nil && !strings.EqualFold(*payload.Email, user.Email) {
+		if taken, err := app.emailTaken(*payload.Email); err != nil {
+			app.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		} else if taken {
+			app.validationErrorJSON(w, r, validator.Errors{"email": {printer(r).Sprintf("email is already in use")}})
+			return
+		}
+	}
+
+	emailChanged := payload.Email != nil && strings.TrimSpace(*payload.Email) != user.Email
+	payload.apply(user)
+
+	err = app.DB.UpdateUser(*user)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the new address is unverified, its owner has to confirm it
+	if emailChanged {
+		if err := app.Mailer.Send(verification.Message(app.Catalog.Printer(app.Catalog.Match(user.Locale)), app.VerificationKey, app.BaseURL, user)); err != nil {
+			log.Println(err)
+		}
+	}
 
+	if payload.Password != nil {
+		err = app.DB.ResetPassword(user.ID, *payload.Password)
+		if err != nil {
+			app.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// refresh tokens issued with the old password can't be used anymore
+		err = app.DB.RevokeUserRefreshTokens(user.ID)
+		if err != nil {
+			app.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *application) deleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		app.errorJSON(w, r, errInvalidUserID)
+		return
+	}
 
+	// make sure the user exists before deleting
+	_, err = app.DB.GetUser(userID)
+	if err != nil {
+		app.userLookupError(w, r, err)
+		return
+	}
+
+	err = app.DB.DeleteUser(userID)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *application) insertUser(w http.ResponseWriter, r *http.Request) {
+	var payload userPayload
+	err := app.readRequest(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if fields := validate(r, payload); fields != nil {
+		app.validationErrorJSON(w, r, fields)
+		return
+	}
+
+	// email addresses must be unique
+	if taken, err := app.emailTaken(payload.Email); err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	} else if taken {
+		app.validationErrorJSON(w, r, validator.Errors{"email": {printer(r).Sprintf("email is already in use")}})
+		return
+	}
+
+	user := data.User{
+		FirstName: strings.TrimSpace(payload.FirstName),
+		LastName:  strings.TrimSpace(payload.LastName),
+		Email:     strings.TrimSpace(payload.Email),
+		Password:  payload.Password,
+		IsAdmin:   payload.IsAdmin,
+	}
+
+	newID, err := app.DB.InsertUser(user)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user.ID = newID
+
+	_ = app.writeResponse(w, r, http.StatusCreated, user)
+}
+
+// unlockUser clears the login lockout of a user.
+func (app *application) unlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		app.errorJSON(w, r, errInvalidUserID)
+		return
+	}
+
+	user, err := app.DB.GetUser(userID)
+	if err != nil {
+		app.userLookupError(w, r, err)
+		return
+	}
+
+	err = app.Lockout.Unlock(user.Email)
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emailTaken reports whether a user with the given email address already exists.
+func (app *application) emailTaken(email string) (bool, error) {
+	_, err := app.DB.GetUserByEmail(strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// userLookupError sends 404 when the user does not exist, and 500 for any other error.
+func (app *application) userLookupError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, r, errUserNotFound)
+		return
+	}
 
+	app.errorJSON(w, r, err, http.StatusInternalServerError)
 }
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/lockout"
+	"webapp/pkg/mailer"
+	"webapp/pkg/verification"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func Test_app_authenticate(t *testing.T) {
@@ -21,6 +34,7 @@ func Test_app_authenticate(t *testing.T) {
 		{"empty-password", `{"email": "admin@example.com"}`, http.StatusUnauthorized},
 		{"invalid-user", `{"email": "invalid@example.com", "password": "secret"}`, http.StatusUnauthorized},
 		{"invalid-password", `{"email": "admin@example.com", "password": "invalid"}`, http.StatusUnauthorized},
+		{"unverified-email", `{"email": "john@example.com", "password": "secret"}`, http.StatusForbidden},
 	}
 
 	for _, e := range tests {
@@ -37,3 +51,540 @@ func Test_app_authenticate(t *testing.T) {
 		}
 	}
 }
+
+func Test_app_allUsers(t *testing.T) {
+	var tests = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedUsers      int
+		expectedTotal      int
+		expectedLimit      int
+		expectNextCursor   bool
+	}{
+		{"all", "", http.StatusOK, 3, 3, 20, false},
+		{"first-page", "?limit=2", http.StatusOK, 2, 3, 2, true},
+		{"admins", "?is_admin=true", http.StatusOK, 1, 1, 20, false},
+		{"created-range", "?created_after=2022-09-01&created_before=2022-10-01", http.StatusOK, 1, 1, 20, false},
+		{"sorted-desc", "?sort=-created_at", http.StatusOK, 3, 3, 20, false},
+		{"invalid-sort", "?sort=password", http.StatusUnprocessableEntity, 0, 0, 0, false},
+		{"invalid-limit", "?limit=1000", http.StatusUnprocessableEntity, 0, 0, 0, false},
+		{"invalid-cursor", "?cursor=abc", http.StatusUnprocessableEntity, 0, 0, 0, false},
+		{"invalid-date", "?created_after=yesterday", http.StatusUnprocessableEntity, 0, 0, 0, false},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/users"+e.query, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.allUsers)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: returned wrong status code; expected %d got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		var list userList
+		_ = json.NewDecoder(rr.Body).Decode(&list)
+
+		if len(list.Users) != e.expectedUsers || list.Metadata.Total != e.expectedTotal {
+			t.Errorf("%s: expected %d of %d users; got %d of %d", e.name, e.expectedUsers, e.expectedTotal, len(list.Users), list.Metadata.Total)
+		}
+
+		// without a limit the default page size is reported, not 0
+		if list.Metadata.Limit != e.expectedLimit {
+			t.Errorf("%s: expected limit %d; got %d", e.name, e.expectedLimit, list.Metadata.Limit)
+		}
+
+		if e.expectNextCursor != (list.Metadata.NextCursor != "") {
+			t.Errorf("%s: unexpected next cursor %q", e.name, list.Metadata.NextCursor)
+		}
+	}
+}
+
+func Test_app_allUsers_nextPage(t *testing.T) {
+	get := func(query string) userList {
+		req, _ := http.NewRequest("GET", "/users"+query, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.allUsers).ServeHTTP(rr, req)
+
+		var list userList
+		_ = json.NewDecoder(rr.Body).Decode(&list)
+
+		return list
+	}
+
+	first := get("?limit=2&sort=id")
+	second := get("?limit=2&sort=id&cursor=" + first.Metadata.NextCursor)
+
+	if len(second.Users) != 1 || second.Users[0].ID != 3 {
+		t.Errorf("expected the second page to hold user 3; got %+v", second.Users)
+	}
+
+	if second.Metadata.NextCursor != "" {
+		t.Error("expected no cursor on the last page")
+	}
+}
+
+func Test_app_getUser(t *testing.T) {
+	var tests = []struct {
+		name               string
+		userID             string
+		expectedStatusCode int
+	}{
+		{"valid", "1", http.StatusOK},
+		{"not-found", "100", http.StatusNotFound},
+		{"invalid-id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/users/"+e.userID, nil)
+		req = addURLParamToRequest(req, "userID", e.userID)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.getUser)
+
+		handler.ServeHTTP(rr, req)
+
+		if e.expectedStatusCode != rr.Code {
+			t.Errorf("%s: returned wrong status code; expected %d got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_insertUser(t *testing.T) {
+	var tests = []struct {
+		name               string
+		requestBody        string
+		expectedStatusCode int
+	}{
+		{"valid", `{"first_name": "Jack", "last_name": "Smith", "email": "jack@example.com", "password": "verysecret1"}`, http.StatusCreated},
+		{"not-json", "not a json", http.StatusBadRequest},
+		{"missing-fields", `{"email": "jack@example.com"}`, http.StatusUnprocessableEntity},
+		{"invalid-email", `{"first_name": "Jack", "last_name": "Smith", "email": "jack", "password": "verysecret1"}`, http.StatusUnprocessableEntity},
+		{"short-password", `{"first_name": "Jack", "last_name": "Smith", "email": "jack@example.com", "password": "short"}`, http.StatusUnprocessableEntity},
+		{"weak-password", `{"first_name": "Jack", "last_name": "Smith", "email": "jack@example.com", "password": "verysecret"}`, http.StatusUnprocessableEntity},
+		{"email-taken", `{"first_name": "Jack", "last_name": "Smith", "email": "admin@example.com", "password": "verysecret1"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("PUT", "/users", strings.NewReader(e.requestBody))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.insertUser)
+
+		handler.ServeHTTP(rr, req)
+
+		if e.expectedStatusCode != rr.Code {
+			t.Errorf("%s: returned wrong status code; expected %d got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_insertUser_fieldErrors(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "/users", strings.NewReader(`{"email": "jack", "password": "short", "is_admin": 2}`))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.insertUser)
+
+	handler.ServeHTTP(rr, req)
+
+	body := decodeProblem(t, rr)
+	fields := problemFields(body)
+
+	if body.Code != "validation_failed" || body.Status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong problem: %+v", body)
+	}
+
+	for _, field := range []string{"first_name", "last_name", "email", "password", "is_admin"} {
+		if len(fields[field]) == 0 {
+			t.Errorf("expected an error for %s; got %v", field, fields)
+		}
+	}
+
+	if got := fields.Get("first_name"); got != "This field is required" {
+		t.Errorf("wrong message for first_name: %q", got)
+	}
+}
+
+func Test_app_weakPasswordErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"insert", "PUT", app.insertUser, `{"first_name": "Jack", "last_name": "Smith", "email": "jack@example.com", "password": "verysecret"}`},
+		{"update", "PATCH", app.updateUser, `{"password": "12345678"}`},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/users/1", strings.NewReader(e.body))
+		req = addURLParamToRequest(req, "userID", "1")
+		req = req.WithContext(contextWithIdentity(req.Context(), identity{UserID: 1, Roles: []string{roleUser}}))
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422; got %d", e.name, rr.Code)
+			continue
+		}
+
+		expected := "Password must be at least 8 characters long and contain letters and digits"
+		if got := problemFields(decodeProblem(t, rr)).Get("password"); got != expected {
+			t.Errorf("%s: expected %q; got %q", e.name, expected, got)
+		}
+	}
+}
+
+func Test_app_insertUser_translatedErrors(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "/users", strings.NewReader(`{"email": "jack@example.com", "password": "verysecret1"}`))
+	req.Header.Set("Accept-Language", "de")
+	rr := httptest.NewRecorder()
+	handler := app.locale(http.HandlerFunc(app.insertUser))
+
+	handler.ServeHTTP(rr, req)
+
+	body := decodeProblem(t, rr)
+
+	if body.Detail != "Prüfung fehlgeschlagen" {
+		t.Errorf("expected a German detail; got %q", body.Detail)
+	}
+
+	if got := problemFields(body).Get("first_name"); got != "Dieses Feld ist erforderlich" {
+		t.Errorf("expected a German field error; got %q", got)
+	}
+
+	if rr.Header().Get("Content-Language") != "de" {
+		t.Errorf("wrong Content-Language: %q", rr.Header().Get("Content-Language"))
+	}
+}
+
+func Test_app_updateUser(t *testing.T) {
+	admin := identity{UserID: 1, Roles: []string{roleUser, roleAdmin}}
+	user := identity{UserID: 1, Roles: []string{roleUser}}
+
+	var tests = []struct {
+		name               string
+		userID             string
+		requestBody        string
+		caller             identity
+		expectedStatusCode int
+	}{
+		{"valid", "1", `{"first_name": "Jack"}`, admin, http.StatusNoContent},
+		{"change-password", "1", `{"password": "verysecret1"}`, user, http.StatusNoContent},
+		{"weak-password", "1", `{"password": "verysecret"}`, user, http.StatusUnprocessableEntity},
+		{"not-found", "100", `{"first_name": "Jack"}`, admin, http.StatusNotFound},
+		{"empty-name", "1", `{"first_name": ""}`, admin, http.StatusUnprocessableEntity},
+		{"invalid-admin-flag", "1", `{"is_admin": 5}`, admin, http.StatusUnprocessableEntity},
+		{"unknown-field", "1", `{"nickname": "jack"}`, admin, http.StatusBadRequest},
+		{"user-grants-admin", "1", `{"is_admin": 1}`, user, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("PATCH", "/users/"+e.userID, strings.NewReader(e.requestBody))
+		req = addURLParamToRequest(req, "userID", e.userID)
+		req = req.WithContext(contextWithIdentity(req.Context(), e.caller))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.updateUser)
+
+		handler.ServeHTTP(rr, req)
+
+		if e.expectedStatusCode != rr.Code {
+			t.Errorf("%s: returned wrong status code; expected %d got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_updateUser_revokesRefreshTokens(t *testing.T) {
+	user, _ := app.DB.GetUser(2)
+	tokens, err := app.generateTokenPair(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("PATCH", "/users/2", strings.NewReader(`{"password": "verysecret1"}`))
+	req = addURLParamToRequest(req, "userID", "2")
+	req = req.WithContext(contextWithIdentity(req.Context(), identity{UserID: 2, Roles: []string{roleUser}}))
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(app.updateUser).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204; got %d", rr.Code)
+	}
+
+	stored, err := app.DB.GetRefreshToken(hashToken(tokens.RefreshToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.RevokedAt.IsZero() {
+		t.Error("refresh token is still valid after the password changed")
+	}
+}
+
+func Test_app_updateUser_sendsVerification(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	var tests = []struct {
+		name          string
+		requestBody   string
+		expectedMails int
+	}{
+		{"new-email", `{"email": "jane.doe@example.com"}`, 1},
+		{"same-email", `{"email": "jane@example.com"}`, 0},
+		{"no-email", `{"first_name": "Janet"}`, 0},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+		req, _ := http.NewRequest("PATCH", "/users/2", strings.NewReader(e.requestBody))
+		req = addURLParamToRequest(req, "userID", "2")
+		req = req.WithContext(contextWithIdentity(req.Context(), identity{UserID: 2, Roles: []string{roleUser}}))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(app.updateUser).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected 204; got %d", e.name, rr.Code)
+		}
+
+		mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(mails) != e.expectedMails {
+			t.Fatalf("%s: expected %d verification mails; got %d", e.name, e.expectedMails, len(mails))
+		}
+
+		// the link is one the web application accepts for the new address
+		for _, m := range mails {
+			content, _ := os.ReadFile(m)
+			match := regexp.MustCompile(`http://localhost:8080/verify-email/confirm\?token=(\S+)`).FindSubmatch(content)
+			if match == nil {
+				t.Fatalf("%s: no verification link in mail: %s", e.name, content)
+			}
+
+			token, _ := url.QueryUnescape(string(match[1]))
+			if id, email, err := verification.Parse(app.VerificationKey, token); err != nil || id != 2 || email != "jane.doe@example.com" {
+				t.Errorf("%s: link does not confirm the new address: %d %s %v", e.name, id, email, err)
+			}
+		}
+	}
+}
+
+func Test_app_deleteUser(t *testing.T) {
+	var tests = []struct {
+		name               string
+		userID             string
+		expectedStatusCode int
+	}{
+		{"valid", "1", http.StatusNoContent},
+		{"not-found", "100", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("DELETE", "/users/"+e.userID, nil)
+		req = addURLParamToRequest(req, "userID", e.userID)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.deleteUser)
+
+		handler.ServeHTTP(rr, req)
+
+		if e.expectedStatusCode != rr.Code {
+			t.Errorf("%s: returned wrong status code; expected %d got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func addURLParamToRequest(req *http.Request, key, value string) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add(key, value)
+
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+}
+
+func Test_app_refresh(t *testing.T) {
+	testUser := data.User{
+		ID:        1,
+		FirstName: "Admin",
+		LastName:  "User",
+		Email:     "admin@example.com",
+	}
+
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	refresh := func(token string) (*httptest.ResponseRecorder, TokenPairs) {
+		body := fmt.Sprintf(`{"refresh_token": "%s"}`, token)
+		req, _ := http.NewRequest("POST", "/refresh-token", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.refresh)
+		handler.ServeHTTP(rr, req)
+
+		var pairs TokenPairs
+		_ = json.NewDecoder(rr.Body).Decode(&pairs)
+
+		return rr, pairs
+	}
+
+	// a valid refresh token gives a new pair
+	rr, rotated := refresh(tokens.RefreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("valid refresh token: expected %d got %d", http.StatusOK, rr.Code)
+	}
+
+	if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+
+	// access tokens can not be used to refresh
+	rr, _ = refresh(tokens.Token)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("access token: expected %d got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// replaying the used token revokes the family
+	rr, _ = refresh(tokens.RefreshToken)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("replayed token: expected %d got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr, _ = refresh(rotated.RefreshToken)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("token of revoked family: expected %d got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// invalid tokens are rejected
+	rr, _ = refresh("invalid")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("invalid token: expected %d got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func Test_app_logout(t *testing.T) {
+	testUser := data.User{ID: 1, FirstName: "Admin", LastName: "User"}
+	tokens, _ := app.generateTokenPair(&testUser)
+
+	handler := app.authRequired(http.HandlerFunc(app.logout))
+
+	// log out with the access token
+	req, _ := http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("logout: expected %d got %d", http.StatusNoContent, rr.Code)
+	}
+
+	// the access token is now revoked
+	req, _ = http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("revoked access token: expected %d got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// and so is the refresh token issued with it
+	body := fmt.Sprintf(`{"refresh_token": "%s"}`, tokens.RefreshToken)
+	req, _ = http.NewRequest("POST", "/refresh-token", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.refresh).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: expected %d got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func Test_app_searchUsers(t *testing.T) {
+	var tests = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedIDs        []int
+	}{
+		{"first-name", "?q=jan", http.StatusOK, []int{2}},
+		{"email", "?q=example.com", http.StatusOK, []int{1, 2, 3}},
+		{"prefix-first", "?q=jo", http.StatusOK, []int{3}},
+		{"limit", "?q=example.com&limit=1", http.StatusOK, []int{1}},
+		{"no-match", "?q=nobody", http.StatusOK, []int{}},
+		{"too-short", "?q=j", http.StatusUnprocessableEntity, nil},
+		{"invalid-limit", "?q=jane&limit=x", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/users/search"+e.query, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.searchUsers).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: returned wrong status code; expected %d got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+
+		if e.expectedIDs == nil {
+			continue
+		}
+
+		var result struct {
+			Users []data.User `json:"users"`
+		}
+		_ = json.NewDecoder(rr.Body).Decode(&result)
+
+		if len(result.Users) != len(e.expectedIDs) {
+			t.Errorf("%s: expected %d users; got %d", e.name, len(e.expectedIDs), len(result.Users))
+			continue
+		}
+
+		for i, id := range e.expectedIDs {
+			if result.Users[i].ID != id {
+				t.Errorf("%s: expected user %d at position %d; got %d", e.name, id, i, result.Users[i].ID)
+			}
+		}
+	}
+}
+
+func Test_app_authenticate_lockout(t *testing.T) {
+	oldLockout := app.Lockout
+	defer func() { app.Lockout = oldLockout }()
+
+	app.Lockout = lockout.New(lockout.NewMemoryStore())
+	app.Lockout.AccountPolicy.MaxFailures = 2
+
+	login := func(body string) int {
+		req, _ := http.NewRequest("POST", "/auth", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.authenticate).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	valid := `{"email": "admin@example.com", "password": "secret"}`
+	invalid := `{"email": "admin@example.com", "password": "invalid"}`
+
+	login(invalid)
+	login(invalid)
+
+	if code := login(valid); code != http.StatusUnauthorized {
+		t.Errorf("locked account: expected %d got %d", http.StatusUnauthorized, code)
+	}
+
+	// an admin clears the lock
+	req, _ := http.NewRequest("DELETE", "/users/1/lock", nil)
+	req = addURLParamToRequest(req, "userID", "1")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.unlockUser).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("unlock: expected %d got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if code := login(valid); code != http.StatusOK {
+		t.Errorf("unlocked account: expected %d got %d", http.StatusOK, code)
+	}
+}
@@ -1,32 +1,109 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+	"webapp/pkg/ratelimit"
 
-func (app *application) enableCORS(next http.Handler) http.Handler {
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *application) authRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http::/localhost:8090")
+		_, claims, err := app.getTokenFromHeaderAndVerify(w, r)
+		if err != nil {
+			app.errorJSON(w, r, tokenError(err))
+			return
+		}
 
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization")
+		// put the caller on the request context
+		id, err := identityFromClaims(claims)
+		if err != nil {
+			app.errorJSON(w, r, errInvalidToken)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(contextWithIdentity(r.Context(), id)))
 	})
 }
 
-func (app *application) authRequired(next http.Handler) http.Handler {
+// requireRole only lets callers through that have at least one of the given roles.
+// It must be used after authRequired.
+func (app *application) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := app.identityFromContext(r.Context())
+			if !ok {
+				app.errorJSON(w, r, errUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if id.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			app.errorJSON(w, r, errForbidden)
+		})
+	}
+}
+
+func (app *application) adminOnly(next http.Handler) http.Handler {
+	return app.requireRole(roleAdmin)(next)
+}
+
+// selfOrAdmin lets admins through, and normal users only when the {userID}
+// url parameter is their own id. It must be used after authRequired.
+func (app *application) selfOrAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, _, err := app.getTokenFromHeaderAndVerify(w, r)
+		id, ok := app.identityFromContext(r.Context())
+		if !ok {
+			app.errorJSON(w, r, errUnauthorized)
+			return
+		}
 
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+		if id.IsAdmin() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+		if err != nil || userID != id.UserID {
+			app.errorJSON(w, r, errForbidden)
 			return
 		}
 
 		next.ServeHTTP(w, r)
-		return
 	})
 }
+
+// rateLimit limits a group of routes to rate requests per client, as returned by key.
+func (app *application) rateLimit(name string, rate ratelimit.Rate, key ratelimit.KeyFunc) func(http.Handler) http.Handler {
+	limiter := &ratelimit.Limiter{
+		Name:  name,
+		Store: app.RateLimit,
+		Rate:  rate,
+		Key:   key,
+		OnLimited: func(w http.ResponseWriter, r *http.Request) {
+			app.errorJSON(w, r, errTooManyRequests)
+		},
+	}
+
+	return limiter.Handler
+}
+
+// limitBySubject limits authenticated requests by user, and others by ip.
+func (app *application) limitBySubject(r *http.Request) string {
+	if id, ok := app.identityFromContext(r.Context()); ok {
+		return "user:" + strconv.Itoa(id.UserID)
+	}
+
+	return "ip:" + app.clientIP(r)
+}
+
+// limitByIP limits requests by the ip address of the client.
+func (app *application) limitByIP(r *http.Request) string {
+	return "ip:" + app.clientIP(r)
+}
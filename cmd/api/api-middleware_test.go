@@ -4,40 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"webapp/pkg/data"
+	"webapp/pkg/netutil"
+	"webapp/pkg/ratelimit"
 )
 
-func Test_app_enableCORS(t *testing.T) {
-	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-
-	var tests = []struct {
-		name         string
-		method       string
-		expectHeader bool
-	}{
-		{"preflight", "OPTIONS", true},
-		{"get", "GET", false},
-	}
-
-	for _, e := range tests {
-		handlerToTest := app.enableCORS(nextHandler)
-
-		req := httptest.NewRequest(e.method, "http://test", nil)
-		rr := httptest.NewRecorder()
-
-		handlerToTest.ServeHTTP(rr, req)
-
-		if e.expectHeader && rr.Header().Get("Access-Control-Allow-Credentials") == "" {
-			t.Errorf("%s: expected header but did not find anything", e.name)
-		}
-
-		if !e.expectHeader && rr.Header().Get("Access-Control-Allow-Credentials") != "" {
-			t.Errorf("%s: not expected header but got one", e.name)
-		}
-	}
-}
-
 func Test_app_authRequired(t *testing.T) {
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
@@ -80,3 +53,142 @@ func Test_app_authRequired(t *testing.T) {
 		}
 	}
 }
+
+func Test_app_authRequired_setsIdentity(t *testing.T) {
+	user := data.User{ID: 1, FirstName: "admin", LastName: "admin", IsAdmin: 1}
+	tokens, _ := app.generateTokenPair(&user)
+
+	var got identity
+	var found bool
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, found = app.identityFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "http://test.com", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	app.authRequired(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if !found {
+		t.Fatal("identity not found in request context")
+	}
+
+	if got.UserID != 1 || !got.IsAdmin() {
+		t.Errorf("wrong identity in context: %+v", got)
+	}
+}
+
+func Test_app_adminOnly(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name         string
+		identity     *identity
+		expectedCode int
+	}{
+		{"admin", &identity{UserID: 1, Roles: []string{roleUser, roleAdmin}}, http.StatusOK},
+		{"user", &identity{UserID: 2, Roles: []string{roleUser}}, http.StatusForbidden},
+		{"anonymous", nil, http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "http://test.com/users", nil)
+		if e.identity != nil {
+			req = req.WithContext(contextWithIdentity(req.Context(), *e.identity))
+		}
+		rr := httptest.NewRecorder()
+
+		app.adminOnly(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_selfOrAdmin(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name         string
+		identity     identity
+		userID       string
+		expectedCode int
+	}{
+		{"self", identity{UserID: 2, Roles: []string{roleUser}}, "2", http.StatusOK},
+		{"other-user", identity{UserID: 2, Roles: []string{roleUser}}, "3", http.StatusForbidden},
+		{"admin", identity{UserID: 1, Roles: []string{roleUser, roleAdmin}}, "3", http.StatusOK},
+		{"invalid-id", identity{UserID: 2, Roles: []string{roleUser}}, "abc", http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "http://test.com/users/"+e.userID, nil)
+		req = addURLParamToRequest(req, "userID", e.userID)
+		req = req.WithContext(contextWithIdentity(req.Context(), e.identity))
+		rr := httptest.NewRecorder()
+
+		app.selfOrAdmin(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_rateLimit(t *testing.T) {
+	oldStore := app.RateLimit
+	defer func() { app.RateLimit = oldStore }()
+	app.RateLimit = ratelimit.NewMemoryStore()
+
+	routes := app.routes()
+
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 11; i++ {
+		req := httptest.NewRequest("POST", "/auth", strings.NewReader("not json"))
+		last = httptest.NewRecorder()
+		routes.ServeHTTP(last, req)
+	}
+
+	if last.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d after 10 requests; got %d", http.StatusTooManyRequests, last.Code)
+	}
+
+	if last.Header().Get("Retry-After") == "" || last.Header().Get("RateLimit-Limit") != "10" {
+		t.Errorf("missing rate limit headers: %v", last.Header())
+	}
+}
+
+func Test_app_rateLimit_trustedProxies(t *testing.T) {
+	oldStore, oldProxies := app.RateLimit, app.TrustedProxies
+	defer func() { app.RateLimit, app.TrustedProxies = oldStore, oldProxies }()
+
+	app.TrustedProxies, _ = netutil.ParseTrustedProxies("10.0.0.1")
+
+	var tests = []struct {
+		name         string
+		remoteAddr   string
+		expectedCode int
+	}{
+		// clients behind the proxy get a bucket each
+		{"behind-proxy", "10.0.0.1:1234", http.StatusUnauthorized},
+		// anyone else can't get a new bucket by sending the header
+		{"spoofed", "192.0.2.1:1234", http.StatusTooManyRequests},
+	}
+
+	for _, e := range tests {
+		app.RateLimit = ratelimit.NewMemoryStore()
+		routes := app.routes()
+
+		var last *httptest.ResponseRecorder
+		for i := 0; i < 11; i++ {
+			req := httptest.NewRequest("POST", "/auth", strings.NewReader("not json"))
+			req.RemoteAddr = e.remoteAddr
+			req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+			last = httptest.NewRecorder()
+			routes.ServeHTTP(last, req)
+		}
+
+		if last.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d for the 11th request; got %d", e.name, e.expectedCode, last.Code)
+		}
+	}
+}
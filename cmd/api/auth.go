@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
@@ -15,12 +19,18 @@ const jwtTokenExpiry = time.Minute * 15
 const refreshTokenExpiry = time.Hour * 24
 
 type TokenPairs struct {
-	Token        string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	XMLName      xml.Name `json:"-" xml:"tokens"`
+	Token        string   `json:"access_token" xml:"access_token"`
+	RefreshToken string   `json:"refresh_token" xml:"refresh_token"`
 }
 
+const refreshTokenType = "refresh"
+
 type Claims struct {
-	UserName string `json:"name"`
+	UserName  string `json:"name"`
+	Admin     bool   `json:"admin"`
+	TokenType string `json:"typ,omitempty"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -33,56 +43,102 @@ func (app *application) getTokenFromHeaderAndVerify(w http.ResponseWriter, r *ht
 
 	// sanity check
 	if authHeader == "" {
-		return "", nil, errors.New("no auth header")
+		return "", nil, errMissingToken
 	}
 
 	// split header on spaces
 	headerParts := strings.Split(authHeader, " ")
 	if len(headerParts) != 2 {
-		return "", nil, errors.New("invalid auth header")
+		return "", nil, errInvalidAuth
 	}
 
 	// check to see we have Bearer in auth-header
 	if headerParts[0] != "Bearer" {
-		return "", nil, errors.New("unauthorizedL no Bearer")
+		return "", nil, errInvalidAuth
 	}
 
 	token := headerParts[1]
 
+	claims, err := app.parseToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// refresh tokens can only be used on the refresh endpoint
+	if claims.TokenType == refreshTokenType {
+		return "", nil, errInvalidToken
+	}
+
+	// tokens without an id can not be revoked, so we don't accept them
+	if claims.ID == "" {
+		return "", nil, errInvalidToken
+	}
+
+	// check the token was not revoked on logout
+	revoked, err := app.Denylist.IsRevoked(claims.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if revoked {
+		return "", nil, errRevokedToken
+	}
+
+	// token is valid
+	return token, claims, nil
+}
+
+// parseToken verifies the signature, expiry, issuer and audience of a token and returns its claims.
+func (app *application) parseToken(token string) (*Claims, error) {
 	// declare empty claims
 	claims := &Claims{}
 
 	// parse the token to out claims
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		// validate the signing method (alg)
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected sigining method: %v", token.Header["alg"])
-		}
-
-		return []byte(app.JWTSecret), nil
-	})
+	// the key ring validates the signing method (alg) and picks the key by kid
+	_, err := jwt.ParseWithClaims(token, claims, app.Keys.keyFunc)
 
 	// check for error, caught also expired tokens
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "token is expired by") {
-			return "", nil, errors.New("expired token")
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errExpiredToken
 		}
 
-		return "", nil, err
+		return nil, err
 	}
 
 	// make sure we issued the token
 	if claims.Issuer != app.Domain {
-		return "", nil, errors.New("incorrect issuer")
+		return nil, errInvalidToken
 	}
 
-	// token is valid
-	return token, claims, nil
+	// and that it was issued for us, not for another audience
+	if !claims.VerifyAudience(app.Domain, true) {
+		return nil, errInvalidToken
+	}
+
+	return claims, nil
 }
 
+// generateTokenPair issues a new token pair, starting a new refresh token family.
 func (app *application) generateTokenPair(user *data.User) (TokenPairs, error) {
+	familyID, err := randomID()
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	return app.generateTokenPairInFamily(user, familyID)
+}
+
+// generateTokenPairInFamily issues a new token pair whose refresh token is stored
+// as part of the given token family.
+func (app *application) generateTokenPairInFamily(user *data.User, familyID string) (TokenPairs, error) {
 	// create the token
-	token := jwt.New(jwt.SigningMethodHS256)
+	token := jwt.New(app.Keys.method())
+
+	tokenID, err := randomID()
+	if err != nil {
+		return TokenPairs{}, err
+	}
 
 	// set claims
 	claims := token.Claims.(jwt.MapClaims)
@@ -90,6 +146,8 @@ func (app *application) generateTokenPair(user *data.User) (TokenPairs, error) {
 	claims["sub"] = fmt.Sprint(user.ID)
 	claims["aud"] = app.Domain
 	claims["iss"] = app.Domain
+	claims["jti"] = tokenID
+	claims["sid"] = familyID
 
 	if user.IsAdmin == 1 {
 		claims["admin"] = true
@@ -101,24 +159,43 @@ func (app *application) generateTokenPair(user *data.User) (TokenPairs, error) {
 	claims["exp"] = time.Now().Add(jwtTokenExpiry).Unix()
 
 	// create the signed token
-	signedAccessToken, err := token.SignedString([]byte(app.JWTSecret))
+	signedAccessToken, err := app.Keys.sign(token)
 	if err != nil {
 		return TokenPairs{}, err
 	}
 
 	// create the refresh token
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
+	refreshToken := jwt.New(app.Keys.method())
 	refreshTokenClaims := refreshToken.Claims.(jwt.MapClaims)
 
+	refreshTokenID, err := randomID()
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
 	refreshTokenClaims["sub"] = fmt.Sprint(user.ID)
 	refreshTokenClaims["aud"] = app.Domain
 	refreshTokenClaims["iss"] = app.Domain
+	refreshTokenClaims["jti"] = refreshTokenID
+	refreshTokenClaims["typ"] = refreshTokenType
 
 	// set expiry longer then refresh token
-	refreshTokenClaims["exp"] = time.Now().Add(refreshTokenExpiry).Unix()
+	refreshExpiry := time.Now().Add(refreshTokenExpiry)
+	refreshTokenClaims["exp"] = refreshExpiry.Unix()
 
 	// create signed refreshToken
-	signedRefreshToken, err := refreshToken.SignedString([]byte(app.JWTSecret))
+	signedRefreshToken, err := app.Keys.sign(refreshToken)
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	// store the refresh token, so it can be rotated and revoked
+	_, err = app.DB.InsertRefreshToken(data.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(signedRefreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: refreshExpiry,
+	})
 	if err != nil {
 		return TokenPairs{}, err
 	}
@@ -130,3 +207,19 @@ func (app *application) generateTokenPair(user *data.User) (TokenPairs, error) {
 
 	return tokenPairs, nil
 }
+
+// hashToken returns the hex encoded sha256 hash of a signed token, this is what we store in the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomID returns a random hex encoded 128 bit identifier.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
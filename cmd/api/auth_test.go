@@ -5,9 +5,53 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	"webapp/pkg/data"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
+func Test_app_parseToken_audience(t *testing.T) {
+	var tests = []struct {
+		name          string
+		audience      any
+		errorExpected bool
+	}{
+		{"ours", app.Domain, false},
+		{"one-of-several", []string{"other.com", app.Domain}, false},
+		{"other-audience", "other.com", true},
+		{"no-audience", nil, true},
+	}
+
+	for _, e := range tests {
+		claims := jwt.MapClaims{
+			"sub": "1",
+			"iss": app.Domain,
+			"jti": "audience-" + e.name,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		if e.audience != nil {
+			claims["aud"] = e.audience
+		}
+
+		token := jwt.New(app.Keys.method())
+		token.Claims = claims
+		signed, err := app.Keys.sign(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = app.parseToken(signed)
+		if err != nil && !e.errorExpected {
+			t.Errorf("%s: did not expect error; got one - %s", e.name, err.Error())
+		}
+
+		if err == nil && e.errorExpected {
+			t.Errorf("%s: expected error; got nothing", e.name)
+		}
+	}
+}
+
 func Test_app_getTokenFromHeaderAndVerify(t *testing.T) {
 	testUser := data.User{
 		ID:        1,
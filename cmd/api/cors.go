@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy decides which cross-origin requests browsers are allowed to make.
+type corsPolicy struct {
+	// AllowedOrigins are exact origins, like https://app.example.com, or patterns
+	// with a wildcard subdomain, like https://*.example.com. A single "*" allows
+	// every origin, but can not be combined with credentials.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+	// Routes narrow down the methods and headers allowed for some routes.
+	Routes []corsRoute
+}
+
+// corsRoute overrides the allowed methods and headers for every path starting
+// with Prefix. Empty lists fall back to the policy.
+type corsRoute struct {
+	Prefix  string
+	Methods []string
+	Headers []string
+}
+
+// corsRoutes are the methods each group of routes actually supports.
+var corsRoutes = []corsRoute{
+	{Prefix: "/auth", Methods: []string{"POST"}},
+	{Prefix: "/refresh-token", Methods: []string{"POST"}},
+	{Prefix: "/logout", Methods: []string{"POST"}},
+	{Prefix: "/users", Methods: []string{"GET", "PUT", "PATCH", "DELETE"}},
+	{Prefix: "/.well-known/", Methods: []string{"GET"}, Headers: []string{"Accept"}},
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// anyOrigin reports whether the policy allows every origin with "*".
+func (p *corsPolicy) anyOrigin() bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate refuses a policy that would let any site make requests with the
+// credentials of the user, as browsers send cookies along.
+func (p *corsPolicy) validate() error {
+	if p.anyOrigin() && p.AllowCredentials {
+		return errors.New(`cors: the origin "*" can not be combined with credentials, list the origins or disable credentials`)
+	}
+
+	return nil
+}
+
+// originAllowed reports whether origin matches one of the allowed origins.
+func (p *corsPolicy) originAllowed(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		// https://*.example.com matches any subdomain of example.com, but not example.com itself
+		if i := strings.Index(allowed, "*."); i >= 0 {
+			prefix, suffix := strings.ToLower(allowed[:i]), strings.ToLower(allowed[i+1:])
+			o := strings.ToLower(origin)
+
+			if strings.HasPrefix(o, prefix) && strings.HasSuffix(o, suffix) && len(o) > len(prefix)+len(suffix) {
+				sub := o[len(prefix) : len(o)-len(suffix)]
+				if !strings.ContainsAny(sub, "/:") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// route returns the methods and headers allowed for path.
+func (p *corsPolicy) route(path string) (methods, headers []string) {
+	methods, headers = p.AllowedMethods, p.AllowedHeaders
+
+	longest := -1
+	for _, rt := range p.Routes {
+		if strings.HasPrefix(path, rt.Prefix) && len(rt.Prefix) > longest {
+			longest = len(rt.Prefix)
+			methods, headers = p.AllowedMethods, p.AllowedHeaders
+
+			if len(rt.Methods) > 0 {
+				methods = rt.Methods
+			}
+			if len(rt.Headers) > 0 {
+				headers = rt.Headers
+			}
+		}
+	}
+
+	return methods, headers
+}
+
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	policy := &app.CORS
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on the origin, so caches must keep them apart
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// not a cross-origin request, or one from an origin we don't allow
+		if origin == "" || !policy.originAllowed(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// any origin is answered with "*", which browsers never send credentials to
+		anyOrigin := policy.anyOrigin()
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if policy.AllowCredentials && !anyOrigin {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			methods, headers := policy.route(r.URL.Path)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+
+			if policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if len(policy.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_app_enableCORS(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		preflight       bool
+		expectedStatus  int
+		expectedOrigin  string
+		expectedMethods string
+	}{
+		{"preflight", "OPTIONS", "/users", "http://localhost:8090", true, http.StatusNoContent, "http://localhost:8090", "GET, PUT, PATCH, DELETE"},
+		{"preflight-auth", "OPTIONS", "/auth", "http://localhost:8090", true, http.StatusNoContent, "http://localhost:8090", "POST"},
+		{"preflight-unknown-route", "OPTIONS", "/test", "http://localhost:8090", true, http.StatusNoContent, "http://localhost:8090", "GET, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"get", "GET", "/users", "http://localhost:8090", false, http.StatusOK, "http://localhost:8090", ""},
+		{"subdomain", "GET", "/users", "https://app.example.com", false, http.StatusOK, "https://app.example.com", ""},
+		{"apex-domain", "GET", "/users", "https://example.com", false, http.StatusOK, "", ""},
+		{"wrong-scheme", "GET", "/users", "http://app.example.com", false, http.StatusOK, "", ""},
+		{"disallowed-origin", "GET", "/users", "https://evil.com", false, http.StatusOK, "", ""},
+		{"disallowed-preflight", "OPTIONS", "/users", "https://evil.com", true, http.StatusNoContent, "", ""},
+		{"no-origin", "GET", "/users", "", false, http.StatusOK, "", ""},
+	}
+
+	for _, e := range tests {
+		handlerToTest := app.enableCORS(nextHandler)
+
+		req := httptest.NewRequest(e.method, e.path, nil)
+		if e.origin != "" {
+			req.Header.Set("Origin", e.origin)
+		}
+		if e.preflight {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		rr := httptest.NewRecorder()
+
+		handlerToTest.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != e.expectedOrigin {
+			t.Errorf("%s: expected allowed origin %q; got %q", e.name, e.expectedOrigin, got)
+		}
+
+		if got := rr.Header().Get("Access-Control-Allow-Methods"); got != e.expectedMethods {
+			t.Errorf("%s: expected allowed methods %q; got %q", e.name, e.expectedMethods, got)
+		}
+
+		credentials := rr.Header().Get("Access-Control-Allow-Credentials")
+		if e.expectedOrigin != "" && credentials != "true" {
+			t.Errorf("%s: expected credentials to be allowed", e.name)
+		}
+		if e.expectedOrigin == "" && credentials != "" {
+			t.Errorf("%s: did not expect credentials header; got %q", e.name, credentials)
+		}
+
+		if e.preflight && e.expectedOrigin != "" && rr.Header().Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("%s: expected max age 600; got %q", e.name, rr.Header().Get("Access-Control-Max-Age"))
+		}
+
+		if rr.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s: expected Vary: Origin; got %q", e.name, rr.Header().Get("Vary"))
+		}
+	}
+}
+
+func Test_corsPolicy_wildcardOrigin(t *testing.T) {
+	var tests = []struct {
+		name                string
+		origins             []string
+		credentials         bool
+		expectedOrigin      string
+		expectedCredentials string
+	}{
+		{"without-credentials", []string{"*"}, false, "*", ""},
+		{"with-credentials", []string{"*"}, true, "*", ""},
+		{"among-others", []string{"https://app.example.com", "*"}, true, "*", ""},
+	}
+
+	oldPolicy := app.CORS
+	defer func() { app.CORS = oldPolicy }()
+
+	for _, e := range tests {
+		app.CORS = corsPolicy{AllowedOrigins: e.origins, AllowCredentials: e.credentials}
+
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("Origin", "https://anything.org")
+		rr := httptest.NewRecorder()
+
+		app.enableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != e.expectedOrigin {
+			t.Errorf("%s: expected allowed origin %q; got %q", e.name, e.expectedOrigin, got)
+		}
+
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != e.expectedCredentials {
+			t.Errorf("%s: expected credentials header %q; got %q", e.name, e.expectedCredentials, got)
+		}
+	}
+}
+
+func Test_corsPolicy_validate(t *testing.T) {
+	var tests = []struct {
+		name          string
+		origins       []string
+		credentials   bool
+		expectedError bool
+	}{
+		{"origins-with-credentials", []string{"https://app.example.com", "https://*.example.com"}, true, false},
+		{"any-origin", []string{"*"}, false, false},
+		{"any-origin-with-credentials", []string{"*"}, true, true},
+		{"any-among-others-with-credentials", []string{"https://app.example.com", "*"}, true, true},
+	}
+
+	for _, e := range tests {
+		policy := corsPolicy{AllowedOrigins: e.origins, AllowCredentials: e.credentials}
+
+		err := policy.validate()
+		if e.expectedError && err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+		if !e.expectedError && err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"webapp/pkg/i18n"
+	"webapp/pkg/validator"
+)
+
+// printer returns the printer of the language of the request, which
+// translates error messages.
+func printer(r *http.Request) *i18n.Printer {
+	return i18n.FromContext(r.Context())
+}
+
+// locale picks the language of the request from Accept-Language. Clients
+// that don't send it get English messages.
+func (app *application) locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := app.Catalog.Printer(app.Catalog.Match(r.Header.Get("Accept-Language")))
+
+		w.Header().Set("Content-Language", p.Tag().String())
+		w.Header().Add("Vary", "Accept-Language")
+
+		next.ServeHTTP(w, r.WithContext(i18n.NewContext(r.Context(), p)))
+	})
+}
+
+// validate checks a decoded payload, with messages in the language of the request.
+func validate(r *http.Request, payload any) validator.Errors {
+	return validator.Validator{Translate: printer(r).Sprintf}.Struct(payload)
+}
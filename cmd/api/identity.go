@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+type contextKey string
+
+const contextIdentityKey contextKey = "identity"
+
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// identity is the authenticated caller of a request, as described by its access token.
+type identity struct {
+	UserID      int
+	Name        string
+	Roles       []string
+	TokenID     string
+	TokenExpiry time.Time
+	SessionID   string
+}
+
+// identityFromClaims builds an identity from the subject and roles of verified claims.
+func identityFromClaims(claims *Claims) (identity, error) {
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return identity{}, errors.New("invalid subject")
+	}
+
+	id := identity{
+		UserID:    userID,
+		Name:      claims.UserName,
+		Roles:     []string{roleUser},
+		TokenID:   claims.ID,
+		SessionID: claims.SessionID,
+	}
+
+	if claims.ExpiresAt != nil {
+		id.TokenExpiry = claims.ExpiresAt.Time
+	}
+
+	if claims.Admin {
+		id.Roles = append(id.Roles, roleAdmin)
+	}
+
+	return id, nil
+}
+
+func (i identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i identity) IsAdmin() bool {
+	return i.HasRole(roleAdmin)
+}
+
+func contextWithIdentity(ctx context.Context, id identity) context.Context {
+	return context.WithValue(ctx, contextIdentityKey, id)
+}
+
+// identityFromContext returns the identity put on the request by authRequired.
+func (app *application) identityFromContext(ctx context.Context) (identity, bool) {
+	id, ok := ctx.Value(contextIdentityKey).(identity)
+	return id, ok
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+	algEdDSA = "EdDSA"
+)
+
+// signingKey is one key tokens can be signed or verified with.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// keyRing holds the key new tokens are signed with, and every key that tokens are
+// still verified with. To rotate keys, add a new key to the keys directory and make
+// it the active one; keep the old key around until the tokens it signed have expired.
+type keyRing struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// newHMACKeyRing returns the legacy key ring, where a shared secret is used both for
+// signing and verifying tokens.
+func newHMACKeyRing(secret string) *keyRing {
+	key := &signingKey{
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+
+	return &keyRing{
+		active: key,
+		keys:   map[string]*signingKey{"": key},
+	}
+}
+
+// loadKeyRing reads every <kid>.pem file in dir. Private keys can sign and verify,
+// public keys can only verify. The key with id activeKID signs new tokens and has
+// to use the algorithm alg.
+func loadKeyRing(alg, dir, activeKID string) (*keyRing, error) {
+	if alg != algRS256 && alg != algEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	ring := &keyRing{keys: make(map[string]*signingKey)}
+
+	for _, file := range files {
+		pemBytes, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := parseKey(kid, pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		ring.keys[kid] = key
+	}
+
+	active, ok := ring.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found in %s", activeKID, dir)
+	}
+
+	if active.private == nil {
+		return nil, fmt.Errorf("active key %q is not a private key", activeKID)
+	}
+
+	if active.Method.Alg() != alg {
+		return nil, fmt.Errorf("active key %q is a %s key, expected %s", activeKID, active.Method.Alg(), alg)
+	}
+
+	ring.active = active
+
+	return ring, nil
+}
+
+// parseKey parses a pem encoded rsa or ed25519 key, private or public.
+func parseKey(kid string, pemBytes []byte) (*signingKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no pem data found")
+	}
+
+	var parsed interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: kid}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// method returns the signing method of the active key.
+func (k *keyRing) method() jwt.SigningMethod {
+	return k.active.Method
+}
+
+// sign signs the token with the active key, adding its id to the kid header.
+func (k *keyRing) sign(token *jwt.Token) (string, error) {
+	if k.active.ID != "" {
+		token.Header["kid"] = k.active.ID
+	}
+
+	return token.SignedString(k.active.private)
+}
+
+// keyFunc finds the key a token has to be verified with, by its kid header. The
+// algorithm of the token has to match the key, so a public key can never be used
+// as a HMAC secret.
+func (k *keyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected sigining method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwks returns the public keys of the ring as a json web key set. Shared HMAC
+// secrets are never published.
+func (k *keyRing) jwks() jsonWebKeySet {
+	set := jsonWebKeySet{Keys: []jsonWebKey{}}
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := k.keys[id]
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	return set
+}
+
+// jwksHandler publishes the public verification keys, so other services can verify our tokens.
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = app.writeJSON(w, http.StatusOK, app.Keys.jwks())
+}
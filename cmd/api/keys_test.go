@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"webapp/pkg/data"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeTestKeys writes an rsa key "rsa-1", an ed25519 key "ed-1" and the public
+// part of an rsa key "rsa-old" into dir.
+func writeTestKeys(t *testing.T, dir string) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "rsa-1.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edBytes, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	writePEM(t, filepath.Join(dir, "ed-1.pem"), "PRIVATE KEY", edBytes)
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBytes, _ := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	writePEM(t, filepath.Join(dir, "rsa-old.pem"), "PUBLIC KEY", oldBytes)
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_loadKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKeys(t, dir)
+
+	var tests = []struct {
+		name          string
+		alg           string
+		kid           string
+		errorExpected bool
+	}{
+		{"rsa", algRS256, "rsa-1", false},
+		{"eddsa", algEdDSA, "ed-1", false},
+		{"wrong-alg", algRS256, "ed-1", true},
+		{"public-key-only", algRS256, "rsa-old", true},
+		{"unknown-kid", algRS256, "nope", true},
+		{"hmac", algHS256, "rsa-1", true},
+	}
+
+	for _, e := range tests {
+		_, err := loadKeyRing(e.alg, dir, e.kid)
+
+		if err != nil && !e.errorExpected {
+			t.Errorf("%s: did not expect error; got %s", e.name, err)
+		}
+
+		if err == nil && e.errorExpected {
+			t.Errorf("%s: expected error; got nothing", e.name)
+		}
+	}
+}
+
+func Test_app_asymmetricTokens(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKeys(t, dir)
+
+	oldKeys := app.Keys
+	defer func() { app.Keys = oldKeys }()
+
+	user := data.User{ID: 1, FirstName: "Admin", LastName: "User", IsAdmin: 1}
+
+	for _, alg := range []struct{ alg, kid string }{{algRS256, "rsa-1"}, {algEdDSA, "ed-1"}} {
+		keys, err := loadKeyRing(alg.alg, dir, alg.kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.Keys = keys
+
+		tokens, err := app.generateTokenPair(&user)
+		if err != nil {
+			t.Fatalf("%s: error generating tokens: %s", alg.alg, err)
+		}
+
+		parsed, _, _ := new(jwt.Parser).ParseUnverified(tokens.Token, &Claims{})
+		if parsed.Header["kid"] != alg.kid || parsed.Header["alg"] != alg.alg {
+			t.Errorf("%s: wrong token header %v", alg.alg, parsed.Header)
+		}
+
+		if _, err := app.parseToken(tokens.Token); err != nil {
+			t.Errorf("%s: could not verify token: %s", alg.alg, err)
+		}
+	}
+
+	// tokens signed by a key that was rotated out still verify while the key is in the ring
+	oldRing, _ := loadKeyRing(algRS256, dir, "rsa-1")
+	app.Keys = oldRing
+	tokens, _ := app.generateTokenPair(&user)
+
+	app.Keys, _ = loadKeyRing(algEdDSA, dir, "ed-1")
+	if _, err := app.parseToken(tokens.Token); err != nil {
+		t.Errorf("token of rotated key did not verify: %s", err)
+	}
+
+	// legacy hmac tokens are rejected once the api signs asymmetrically
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1", "iss": app.Domain})
+	signed, _ := hmacToken.SignedString([]byte(app.JWTSecret))
+	if _, err := app.parseToken(signed); err == nil {
+		t.Error("hmac token accepted by asymmetric key ring")
+	}
+
+	// a token claiming hmac with the kid of a public key must not verify
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1", "iss": app.Domain})
+	confused.Header["kid"] = "rsa-1"
+	pubDER, _ := x509.MarshalPKIXPublicKey(oldRing.keys["rsa-1"].public)
+	signed, _ = confused.SignedString(pubDER)
+	if _, err := app.parseToken(signed); err == nil {
+		t.Error("accepted hmac token signed with a public key")
+	}
+}
+
+func Test_app_jwksHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKeys(t, dir)
+
+	oldKeys := app.Keys
+	defer func() { app.Keys = oldKeys }()
+
+	var tests = []struct {
+		name         string
+		keys         func() *keyRing
+		expectedKeys int
+	}{
+		{"hmac", func() *keyRing { return newHMACKeyRing("secret") }, 0},
+		{"asymmetric", func() *keyRing { k, _ := loadKeyRing(algRS256, dir, "rsa-1"); return k }, 3},
+	}
+
+	for _, e := range tests {
+		app.Keys = e.keys()
+
+		req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.jwksHandler).ServeHTTP(rr, req)
+
+		var set jsonWebKeySet
+		if err := json.NewDecoder(rr.Body).Decode(&set); err != nil {
+			t.Fatalf("%s: could not decode jwks: %s", e.name, err)
+		}
+
+		if len(set.Keys) != e.expectedKeys {
+			t.Errorf("%s: expected %d keys; got %d", e.name, e.expectedKeys, len(set.Keys))
+		}
+
+		for _, k := range set.Keys {
+			if k.Kid == "" || k.Use != "sig" {
+				t.Errorf("%s: incomplete key %s", e.name, fmt.Sprint(k))
+			}
+		}
+	}
+}
@@ -5,6 +5,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	"webapp/locales"
+	"webapp/pkg/denylist"
+	"webapp/pkg/i18n"
+	"webapp/pkg/lockout"
+	"webapp/pkg/mailer"
+	"webapp/pkg/netutil"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository"
 	"webapp/pkg/repository/dbrepo"
 )
@@ -16,6 +25,20 @@ type application struct {
 	DB        repository.DatabaseRepo
 	Domain    string
 	JWTSecret string
+	Keys      *keyRing
+	Denylist  denylist.Store
+	Lockout   *lockout.Guard
+	RateLimit ratelimit.Store
+	CORS      corsPolicy
+	Catalog   *i18n.Catalog
+	// TrustedProxies may set X-Forwarded-For, see clientIP
+	TrustedProxies netutil.TrustedProxies
+
+	// BaseURL is the public url of the web application, which confirms the
+	// links of verification emails signed with VerificationKey
+	BaseURL         string
+	VerificationKey []byte
+	Mailer          mailer.Mailer
 }
 
 func main() {
@@ -24,8 +47,89 @@ func main() {
 	flag.StringVar(&app.Domain, "domain", "example.com", "Domain for application")
 	flag.StringVar(&app.DSN, "dsn", "host=localhost port=6432 user=postgres password=postgres dbname=users sslmode=disable timezone=UTC connect_timeout=5", "postgres connection")
 	flag.StringVar(&app.JWTSecret, "jwt-secret", "teasd32safasd1zvczvckxbnz82q", "signing secret")
+	jwtAlg := flag.String("jwt-alg", algHS256, "token signing algorithm: HS256|RS256|EdDSA")
+	jwtKeysDir := flag.String("jwt-keys-dir", "./keys", "directory with <kid>.pem signing and verification keys")
+	jwtKID := flag.String("jwt-kid", "", "id of the key new tokens are signed with")
+	denylistStore := flag.String("denylist", "postgres", "where revoked tokens are kept: memory|postgres")
+	lockoutStore := flag.String("lockout-store", "postgres", "where failed logins are counted: memory|postgres")
+	trustedProxies := flag.String("trusted-proxies", envOr("TRUSTED_PROXIES", ""), "comma separated addresses or networks of proxies whose X-Forwarded-For is believed")
+	corsOrigins := flag.String("cors-allowed-origins", envOr("CORS_ALLOWED_ORIGINS", "http://localhost:8090"), "comma separated origins allowed to call the api, like https://*.example.com")
+	corsMethods := flag.String("cors-allowed-methods", envOr("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"), "comma separated methods allowed in cross-origin requests")
+	corsHeaders := flag.String("cors-allowed-headers", envOr("CORS_ALLOWED_HEADERS", "Accept,Content-Type,X-CSRF-Token,Authorization"), "comma separated headers allowed in cross-origin requests")
+	corsCredentials := flag.Bool("cors-allow-credentials", envOr("CORS_ALLOW_CREDENTIALS", "true") == "true", "allow cross-origin requests with credentials")
+	defaultCORSMaxAge, err := time.ParseDuration(envOr("CORS_MAX_AGE", "10m"))
+	if err != nil {
+		log.Fatalf("invalid CORS_MAX_AGE: %s", err)
+	}
+	corsMaxAge := flag.Duration("cors-max-age", defaultCORSMaxAge, "how long browsers can cache preflight responses")
+	rateLimitStore := flag.String("rate-limit-store", "postgres", "where rate limit buckets are kept: memory|postgres")
+	flag.StringVar(&app.BaseURL, "base-url", envOr("BASE_URL", "http://localhost:8080"), "public url of the web application, used in links sent by email")
+	verificationKey := flag.String("verification-key", os.Getenv("VERIFICATION_KEY"), "secret used to sign email verification links, the same as the web application's")
+	mailerKind := flag.String("mailer", "file", "how emails are sent: file|smtp")
+	mailDir := flag.String("mail-dir", "", "directory the file mailer writes emails to, they are logged when empty")
+	mailFrom := flag.String("mail-from", "no-reply@example.com", "sender address of emails")
+	smtpHost := flag.String("smtp-host", "localhost", "smtp server host")
+	smtpPort := flag.Int("smtp-port", 587, "smtp server port")
+	smtpUser := flag.String("smtp-user", "", "smtp username, leave empty to send without authentication")
+	smtpPassword := flag.String("smtp-password", "", "smtp password")
 	flag.Parse()
 
+	// changed email addresses are confirmed with links the web application checks
+	if *verificationKey == "" {
+		log.Fatal("a verification key is required, set -verification-key or VERIFICATION_KEY")
+	}
+	app.VerificationKey = []byte(*verificationKey)
+
+	switch *mailerKind {
+	case "file":
+		app.Mailer = &mailer.FileMailer{Dir: *mailDir, From: *mailFrom}
+	case "smtp":
+		app.Mailer = &mailer.SMTPMailer{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUser,
+			Password: *smtpPassword,
+			From:     *mailFrom,
+		}
+	default:
+		log.Fatalf("unknown mailer %q", *mailerKind)
+	}
+
+	app.CORS = corsPolicy{
+		AllowedOrigins:   splitList(*corsOrigins),
+		AllowedMethods:   splitList(*corsMethods),
+		AllowedHeaders:   splitList(*corsHeaders),
+		ExposedHeaders:   []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", requestIDHeader},
+		AllowCredentials: *corsCredentials,
+		MaxAge:           *corsMaxAge,
+		Routes:           corsRoutes,
+	}
+	if err := app.CORS.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	app.TrustedProxies, err = netutil.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// translations of the error messages
+	app.Catalog, err = i18n.Load(locales.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// HS256 is the legacy mode, using the shared jwt-secret
+	if *jwtAlg == algHS256 {
+		app.Keys = newHMACKeyRing(app.JWTSecret)
+	} else {
+		keys, err := loadKeyRing(*jwtAlg, *jwtKeysDir, *jwtKID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.Keys = keys
+	}
+
 	conn, err := app.connectToDB()
 	if err != nil {
 		log.Fatal(err)
@@ -36,6 +140,42 @@ func main() {
 		DB: conn,
 	}
 
+	// set up the denylist of revoked tokens, and clean it up every hour
+	switch *denylistStore {
+	case "memory":
+		app.Denylist = denylist.NewMemoryStore()
+	case "postgres":
+		app.Denylist = &denylist.PostgresStore{DB: conn}
+	default:
+		log.Fatalf("unknown denylist store %q", *denylistStore)
+	}
+	stopCleanup := denylist.StartCleanup(app.Denylist, time.Hour)
+	defer stopCleanup()
+
+	// count failed logins, to lock out brute force attacks
+	switch *lockoutStore {
+	case "memory":
+		app.Lockout = lockout.New(lockout.NewMemoryStore())
+	case "postgres":
+		app.Lockout = lockout.New(&lockout.PostgresStore{DB: conn})
+	default:
+		log.Fatalf("unknown lockout store %q", *lockoutStore)
+	}
+	stopLockoutCleanup := app.Lockout.StartCleanup(time.Hour)
+	defer stopLockoutCleanup()
+
+	// rate limit buckets, shared by every instance when kept in postgres
+	switch *rateLimitStore {
+	case "memory":
+		app.RateLimit = ratelimit.NewMemoryStore()
+	case "postgres":
+		app.RateLimit = &ratelimit.PostgresStore{DB: conn}
+	default:
+		log.Fatalf("unknown rate limit store %q", *rateLimitStore)
+	}
+	stopRateLimitCleanup := ratelimit.StartCleanup(app.RateLimit, time.Hour, time.Hour)
+	defer stopRateLimitCleanup()
+
 	log.Printf("starting api on port %d", port)
 
 	err = http.ListenAndServe(fmt.Sprintf(":%d", port), app.routes())
@@ -43,3 +183,12 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// envOr returns the environment variable key, or fallback when it is not set.
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+
+	return fallback
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/validator"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// the errors of negotiation, like those of problems.go
+var (
+	errNotAcceptable        = &apiError{http.StatusNotAcceptable, "not_acceptable", "none of the accepted media types can be sent"}
+	errUnsupportedMediaType = &apiError{http.StatusUnsupportedMediaType, "unsupported_media_type", "content type is not supported"}
+)
+
+// the errors of reading a body, with the same message in every format, so
+// clients get the same problem detail whatever they send
+var (
+	errMalformedBody  = errors.New("body is not well-formed")
+	errMultipleValues = errors.New("body must only contain a single value")
+)
+
+// unknownFieldError is the error of a body with a field the payload doesn't have.
+func unknownFieldError(name string) error {
+	return fmt.Errorf("body contains unknown field %q", name)
+}
+
+// unknownField returns the field of err when it is the unknown field error of
+// a decoder, which encoding/json and msgpack both send as: prefix: unknown
+// field "name".
+func unknownField(err error, prefix string) (string, bool) {
+	quoted, ok := strings.CutPrefix(err.Error(), prefix+": unknown field ")
+	if !ok {
+		return "", false
+	}
+
+	name, err := strconv.Unquote(quoted)
+
+	return name, err == nil
+}
+
+// format is a media type responses can be sent in.
+type format struct {
+	mediaType   string
+	contentType string
+	encode      func(w io.Writer, data any, wrap string) error
+	// collections only, like the user list
+	collection bool
+}
+
+// formats are offered in this order, the first one is used when the client
+// doesn't care. Aliases of a media type are answered with the alias.
+var formats = []format{
+	{"application/json", "application/json", encodeJSON, false},
+	{"application/xml", "application/xml; charset=utf-8", encodeXML, false},
+	{"text/xml", "text/xml; charset=utf-8", encodeXML, false},
+	{"application/msgpack", "application/msgpack", encodeMsgpack, false},
+	{"application/x-msgpack", "application/x-msgpack", encodeMsgpack, false},
+	{"application/vnd.msgpack", "application/vnd.msgpack", encodeMsgpack, false},
+	{"text/csv", "text/csv; charset=utf-8", encodeCSV, true},
+}
+
+// collection is implemented by responses that are a list with metadata, so
+// the list alone can be sent as csv.
+type collection interface {
+	items() any
+}
+
+// writeResponse sends data in the format that suits the Accept header of the
+// request best: json, xml, msgpack, or csv for collections. It sends a 406
+// problem when none of them is accepted. Like writeJSON, data can be wrapped
+// in an object named wrap.
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data any, wrap ...string) error {
+	w.Header().Add("Vary", "Accept")
+
+	offers := make([]string, 0, len(formats))
+	for _, f := range formats {
+		if !f.collection || isCollection(data) {
+			offers = append(offers, f.mediaType)
+		}
+	}
+
+	mediaType := negotiate(r.Header.Get("Accept"), offers)
+	if mediaType == "" {
+		app.errorJSON(w, r, errNotAcceptable)
+		return errNotAcceptable
+	}
+
+	var f format
+	for _, f = range formats {
+		if f.mediaType == mediaType {
+			break
+		}
+	}
+
+	name := ""
+	if len(wrap) > 0 {
+		name = wrap[0]
+	}
+
+	// encode first, so an error can still be sent as one
+	var buf bytes.Buffer
+	if err := f.encode(&buf, data, name); err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", f.contentType)
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// negotiate returns the offer the client prefers according to accept, the
+// value of an Accept header, or an empty string when it accepts none of them.
+// Without an Accept header, every offer is accepted, and the first one wins.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// the most specific range that matches decides the quality of an offer
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			s := -1
+			switch {
+			case mr.mediaType == offer:
+				s = 2
+			case strings.HasSuffix(mr.mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mr.mediaType, "*")):
+				s = 1
+			case mr.mediaType == "*/*":
+				s = 0
+			}
+
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// isCollection reports whether data is a list, or a collection of one.
+func isCollection(data any) bool {
+	if c, ok := data.(collection); ok {
+		data = c.items()
+	}
+
+	v := reflect.ValueOf(data)
+
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
+
+func encodeJSON(w io.Writer, data any, wrap string) error {
+	if wrap != "" {
+		data = map[string]any{wrap: data}
+	}
+
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+
+	return err
+}
+
+func encodeMsgpack(w io.Writer, data any, wrap string) error {
+	if wrap != "" {
+		data = map[string]any{wrap: data}
+	}
+
+	// the field names are the same as in json
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+
+	return enc.Encode(data)
+}
+
+// encodeXML encodes data as an xml document. Lists are put in an element
+// named wrap, or items, that holds an element per item.
+func encodeXML(w io.Writer, data any, wrap string) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		if wrap == "" {
+			return enc.Encode(data)
+		}
+		return enc.EncodeElement(data, xml.StartElement{Name: xml.Name{Local: wrap}})
+	}
+
+	if wrap == "" {
+		wrap = "items"
+	}
+	start := xml.StartElement{Name: xml.Name{Local: wrap}}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.Encode(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.EncodeToken(start.End()); err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+// encodeCSV encodes a list of structs as csv, with a header row of the json
+// names of the fields. Collections are sent without their metadata.
+func encodeCSV(w io.Writer, data any, wrap string) error {
+	if c, ok := data.(collection); ok {
+		data = c.items()
+	}
+
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("csv: %T is not a list", data)
+	}
+
+	itemType := v.Type().Elem()
+	if itemType.Kind() == reflect.Pointer {
+		itemType = itemType.Elem()
+	}
+	if itemType.Kind() != reflect.Struct {
+		return fmt.Errorf("csv: %s is not a struct", itemType)
+	}
+
+	var header []string
+	var columns []int
+	for i := 0; i < itemType.NumField(); i++ {
+		sf := itemType.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("json") == "-" || sf.Type == reflect.TypeOf(xml.Name{}) {
+			continue
+		}
+
+		header = append(header, validator.FieldName(sf))
+		columns = append(columns, i)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		if !item.IsValid() {
+			continue
+		}
+
+		for j, column := range columns {
+			record[j] = csvValue(item.Field(column))
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// csvValue formats one field. Text that a spreadsheet would run as a formula
+// is prefixed with a quote, so a name like =HYPERLINK(...) stays a name.
+func csvValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	if v.Kind() == reflect.String {
+		s := v.String()
+		if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+			return "'" + s
+		}
+		return s
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// readRequest decodes the body of the request into data, by its Content-Type:
+// json, which is also assumed when there is none, xml or msgpack. Other types
+// are answered with a 415 problem by errorJSON.
+func (app *application) readRequest(w http.ResponseWriter, r *http.Request, data any) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return app.readJSON(w, r, data)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errUnsupportedMediaType
+	}
+
+	maxBytes := 1024 * 1024 // one megabyte
+
+	switch mediaType {
+	case "application/json":
+		return app.readJSON(w, r, data)
+
+	case "application/xml", "text/xml":
+		r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+		return readXML(r.Body, data)
+
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+		dec := msgpack.NewDecoder(r.Body)
+		dec.SetCustomStructTag("json")
+		dec.DisallowUnknownFields(true)
+
+		if err := dec.Decode(data); err != nil {
+			if name, ok := unknownField(err, "msgpack"); ok {
+				return unknownFieldError(name)
+			}
+			return err
+		}
+
+		// make sure only one value in payload
+		if _, err := dec.DecodeInterface(); !errors.Is(err, io.EOF) {
+			return errMultipleValues
+		}
+
+		return nil
+	}
+
+	return errUnsupportedMediaType
+}
+
+// readXML decodes one xml document into data, with the checks readJSON makes:
+// elements data has no field for, and anything but whitespace after the
+// document, are errors.
+func readXML(body io.Reader, data any) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	var syntaxErr *xml.SyntaxError
+	if err := dec.Decode(data); errors.As(err, &syntaxErr) {
+		return errMalformedBody
+	} else if err != nil {
+		return err
+	}
+
+	if name := unknownXMLField(b, data); name != "" {
+		return unknownFieldError(name)
+	}
+
+	// make sure only one document in payload, and no text after it
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return errMultipleValues
+		}
+
+		switch tok := tok.(type) {
+		case xml.Comment, xml.ProcInst:
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return errMultipleValues
+			}
+		default:
+			return errMultipleValues
+		}
+	}
+}
+
+// unknownXMLField returns the name of the first element of the document b that
+// is not a field of the struct data, or an empty string.
+func unknownXMLField(b []byte, data any) string {
+	t := reflect.TypeOf(data)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Type == reflect.TypeOf(xml.Name{}) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get("xml"), ",")
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = true
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && !fields[tok.Name.Local] {
+				return tok.Name.Local
+			}
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				return ""
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func Test_negotiate(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/csv"}
+
+	var tests = []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{"no-header", "", "application/json"},
+		{"anything", "*/*", "application/json"},
+		{"exact", "text/csv", "text/csv"},
+		{"ties-in-server-order", "text/csv, application/xml", "application/xml"},
+		{"quality", "application/json;q=0.5, application/xml", "application/xml"},
+		{"type-wildcard", "text/*", "text/csv"},
+		{"specific-beats-wildcard", "application/*;q=0.9, application/json;q=0.1", "application/xml"},
+		{"excluded", "*/*, application/json;q=0", "application/xml"},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/xml"},
+		{"none", "image/png", ""},
+		{"garbage", "not a media type", ""},
+	}
+
+	for _, e := range tests {
+		if got := negotiate(e.accept, offers); got != e.expected {
+			t.Errorf("%s: expected %q; got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func testUserList() userList {
+	return userList{
+		Users: []*data.User{
+			{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1},
+			{ID: 2, FirstName: "=HYPERLINK(\"http://evil\")", LastName: "Doe, Jr.", Email: "jane@example.com", Password: "secret"},
+		},
+		Metadata: listMetadata{Total: 2, Limit: 20},
+	}
+}
+
+func Test_app_writeResponse(t *testing.T) {
+	var tests = []struct {
+		name                string
+		accept              string
+		data                any
+		wrap                string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        []string
+	}{
+		{"json", "", testUserList(), "", http.StatusOK, "application/json", []string{`"users":[{"id":1,"first_name":"Admin"`, `"metadata":{"total":2,"limit":20}`}},
+		{"xml", "application/xml", testUserList(), "", http.StatusOK, "application/xml; charset=utf-8", []string{"<?xml", "<user_list><users><user><id>1</id><first_name>Admin</first_name>", "<metadata><total>2</total>"}},
+		{"xml-list", "text/xml", testUserList().Users, "users", http.StatusOK, "text/xml; charset=utf-8", []string{"<users><user><id>1</id>", "</user><user><id>2</id>", "</user></users>"}},
+		{"xml-single", "application/xml", testUserList().Users[0], "", http.StatusOK, "application/xml; charset=utf-8", []string{"<user><id>1</id>"}},
+		{"csv", "text/csv", testUserList(), "", http.StatusOK, "text/csv; charset=utf-8", []string{"id,first_name,last_name,email,is_admin\n1,Admin,User,admin@example.com,1\n", `2,"'=HYPERLINK(""http://evil"")","Doe, Jr.",jane@example.com,0`}},
+		{"csv-not-for-single", "text/csv", testUserList().Users[0], "", http.StatusNotAcceptable, "application/problem+json", []string{`"code":"not_acceptable"`}},
+		{"not-acceptable", "image/png", testUserList(), "", http.StatusNotAcceptable, "application/problem+json", []string{`"code":"not_acceptable"`}},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/users", nil)
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+		rr := httptest.NewRecorder()
+
+		var wrap []string
+		if e.wrap != "" {
+			wrap = append(wrap, e.wrap)
+		}
+		_ = app.writeResponse(rr, req, http.StatusOK, e.data, wrap...)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != e.expectedContentType {
+			t.Errorf("%s: expected content type %q; got %q", e.name, e.expectedContentType, ct)
+		}
+
+		if rr.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s: expected Vary: Accept", e.name)
+		}
+
+		body := rr.Body.String()
+		for _, expected := range e.expectedBody {
+			if !strings.Contains(body, expected) {
+				t.Errorf("%s: expected %s in %s", e.name, expected, body)
+			}
+		}
+
+		if strings.Contains(body, "secret") {
+			t.Errorf("%s: password was sent: %s", e.name, body)
+		}
+	}
+}
+
+func Test_app_writeResponse_msgpack(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", "application/x-msgpack")
+	rr := httptest.NewRecorder()
+
+	_ = app.writeResponse(rr, req, http.StatusOK, testUserList())
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-msgpack" {
+		t.Errorf("expected the alias that was asked for; got %q", ct)
+	}
+
+	var body map[string]any
+	if err := msgpack.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	users, _ := body["users"].([]any)
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users; got %v", body)
+	}
+
+	first, _ := users[0].(map[string]any)
+	if first["first_name"] != "Admin" || first["email"] != "admin@example.com" {
+		t.Errorf("expected the json field names; got %v", first)
+	}
+
+	if _, ok := first["Password"]; ok {
+		t.Error("password was sent")
+	}
+}
+
+func Test_app_readRequest(t *testing.T) {
+	packed, _ := msgpack.Marshal(map[string]any{"first_name": "Jack", "is_admin": 1})
+	unknown, _ := msgpack.Marshal(map[string]any{"nickname": "Jack"})
+
+	var tests = []struct {
+		name          string
+		contentType   string
+		body          []byte
+		expectedError bool
+	}{
+		{"no-content-type", "", []byte(`{"first_name": "Jack", "is_admin": 1}`), false},
+		{"json", "application/json; charset=utf-8", []byte(`{"first_name": "Jack", "is_admin": 1}`), false},
+		{"xml", "application/xml", []byte(`<user><first_name>Jack</first_name><is_admin>1</is_admin></user>`), false},
+		{"msgpack", "application/msgpack", packed, false},
+		{"msgpack-unknown-field", "application/msgpack", unknown, true},
+		{"msgpack-two-values", "application/msgpack", append(append([]byte{}, packed...), packed...), true},
+		{"invalid-xml", "text/xml", []byte(`<user><first_name>Jack`), true},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("PATCH", "/users/1", bytes.NewReader(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+
+		var payload userPatch
+		err := app.readRequest(httptest.NewRecorder(), req, &payload)
+
+		if e.expectedError {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		if payload.FirstName == nil || *payload.FirstName != "Jack" || payload.IsAdmin == nil || *payload.IsAdmin != 1 {
+			t.Errorf("%s: wrong payload: %+v", e.name, payload)
+		}
+
+		if payload.LastName != nil {
+			t.Errorf("%s: expected fields that were not sent to stay nil", e.name)
+		}
+	}
+}
+
+func Test_app_readRequest_errors(t *testing.T) {
+	packed, _ := msgpack.Marshal(map[string]any{"first_name": "Jack"})
+	unknown, _ := msgpack.Marshal(map[string]any{"nickname": "Jack"})
+
+	var tests = []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedDetail string
+	}{
+		{"json-malformed", "application/json", `{"first_name": "Jack"`, "body is not well-formed"},
+		{"json-unknown-field", "application/json", `{"nickname": "jack"}`, `body contains unknown field "nickname"`},
+		{"json-trailing", "application/json", `{"first_name": "Jack"}{}`, "body must only contain a single value"},
+		{"xml-malformed", "application/xml", `<user><first_name>Jack</user>`, "body is not well-formed"},
+		{"xml-unclosed", "text/xml", `<user><first_name>Jack`, "body is not well-formed"},
+		{"xml-unknown-field", "application/xml", `<user><nickname>jack</nickname></user>`, `body contains unknown field "nickname"`},
+		{"xml-trailing-document", "application/xml", `<user><first_name>Jack</first_name></user><user></user>`, "body must only contain a single value"},
+		{"xml-trailing-text", "application/xml", `<user><first_name>Jack</first_name></user>junk`, "body must only contain a single value"},
+		{"xml-trailing-garbage", "application/xml", `<user><first_name>Jack</first_name></user><`, "body must only contain a single value"},
+		{"msgpack-unknown-field", "application/msgpack", string(unknown), `body contains unknown field "nickname"`},
+		{"msgpack-trailing", "application/msgpack", string(packed) + string(packed), "body must only contain a single value"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("PATCH", "/users/1", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+		rr := httptest.NewRecorder()
+
+		var payload userPatch
+		err := app.readRequest(rr, req, &payload)
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+			continue
+		}
+
+		// the problem is the same whatever the format of the body
+		app.errorJSON(rr, req, err)
+		p := decodeProblem(t, rr)
+
+		if p.Status != http.StatusBadRequest || p.Detail != e.expectedDetail {
+			t.Errorf("%s: expected 400 %q; got %d %q", e.name, e.expectedDetail, p.Status, p.Detail)
+		}
+	}
+}
+
+func Test_app_readRequest_xmlWhitespace(t *testing.T) {
+	body := "<?xml version=\"1.0\"?>\n<user>\n  <first_name>Jack</first_name>\n</user>\n<!-- sent by a client -->\n"
+	req, _ := http.NewRequest("PATCH", "/users/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml")
+
+	var payload userPatch
+	if err := app.readRequest(httptest.NewRecorder(), req, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.FirstName == nil || *payload.FirstName != "Jack" {
+		t.Errorf("wrong payload: %+v", payload)
+	}
+}
+
+func Test_app_readRequest_unsupported(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "/users", strings.NewReader("first_name=Jack"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(app.insertUser)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415; got %d", rr.Code)
+	}
+
+	var payload userPatch
+	err := app.readRequest(rr, req, &payload)
+	if !errors.Is(err, errUnsupportedMediaType) {
+		t.Errorf("expected errUnsupportedMediaType; got %v", err)
+	}
+}
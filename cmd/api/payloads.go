@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/repository"
+	"webapp/pkg/validator"
+)
+
+// userPayload is the body used to create a user.
+type userPayload struct {
+	FirstName string `json:"first_name" xml:"first_name" validate:"required,max=255"`
+	LastName  string `json:"last_name" xml:"last_name" validate:"required,max=255"`
+	Email     string `json:"email" xml:"email" validate:"required,email,max=255"`
+	Password  string `json:"password" xml:"password" validate:"required,password=8"`
+	IsAdmin   int    `json:"is_admin" xml:"is_admin" validate:"oneof=0 1"`
+}
+
+// userPatch is the body used to update a user, only the fields that are
+// present in the body are changed, and checked.
+type userPatch struct {
+	FirstName *string `json:"first_name" xml:"first_name" validate:"required,max=255"`
+	LastName  *string `json:"last_name" xml:"last_name" validate:"required,max=255"`
+	Email     *string `json:"email" xml:"email" validate:"required,email,max=255"`
+	Password  *string `json:"password" xml:"password" validate:"required,password=8"`
+	IsAdmin   *int    `json:"is_admin" xml:"is_admin" validate:"oneof=0 1"`
+}
+
+// apply copies the fields that were sent onto the user.
+func (p userPatch) apply(user *data.User) {
+	if p.FirstName != nil {
+		user.FirstName = strings.TrimSpace(*p.FirstName)
+	}
+
+	if p.LastName != nil {
+		user.LastName = strings.TrimSpace(*p.LastName)
+	}
+
+	if p.Email != nil {
+		user.Email = strings.TrimSpace(*p.Email)
+	}
+
+	if p.IsAdmin != nil {
+		user.IsAdmin = *p.IsAdmin
+	}
+}
+
+// listOptionsFromQuery reads the options of a user listing from the query
+// string. Errors are translated by p.
+func listOptionsFromQuery(q url.Values, p *i18n.Printer) (repository.ListOptions, validator.Errors) {
+	fields := validator.Errors{}
+	opts := repository.ListOptions{
+		Cursor: q.Get("cursor"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > repository.MaxListLimit {
+			fields.Add("limit", p.Sprintf("limit must be a number between 1 and 100"))
+		}
+		opts.Limit = limit
+	}
+
+	if v := q.Get("sort"); v != "" {
+		opts.Sort = strings.TrimPrefix(v, "-")
+		opts.Desc = strings.HasPrefix(v, "-")
+
+		if !repository.IsUserSortField(opts.Sort) {
+			fields.Add("sort", p.Sprintf("sort must be one of %s", strings.Join(repository.UserSortFields, ", ")))
+		}
+	}
+
+	if v := q.Get("is_admin"); v != "" {
+		isAdmin, err := strconv.ParseBool(v)
+		if err != nil {
+			fields.Add("is_admin", p.Sprintf("is_admin must be true or false"))
+		}
+
+		flag := 0
+		if isAdmin {
+			flag = 1
+		}
+		opts.IsAdmin = &flag
+	}
+
+	if v := q.Get("created_after"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			fields.Add("created_after", p.Sprintf("created_after must be a date or RFC 3339 timestamp"))
+		}
+		opts.CreatedAfter = t
+	}
+
+	if v := q.Get("created_before"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			fields.Add("created_before", p.Sprintf("created_before must be a date or RFC 3339 timestamp"))
+		}
+		opts.CreatedBefore = t
+	}
+
+	return opts, fields
+}
+
+// parseQueryTime accepts either a date (2006-01-02) or a RFC 3339 timestamp.
+func parseQueryTime(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"webapp/pkg/validator"
+)
+
+// apiError is an error the api sends to clients. Code is stable, so clients
+// can match on it, while Detail is a message for people, and is translated.
+type apiError struct {
+	Status int
+	Code   string
+	Detail string
+}
+
+func (e *apiError) Error() string {
+	return e.Detail
+}
+
+// the errors of the api, clients can rely on their codes
+var (
+	errBadRequest       = &apiError{http.StatusBadRequest, "bad_request", "bad request"}
+	errInvalidUserID    = &apiError{http.StatusBadRequest, "invalid_user_id", "invalid user id"}
+	errUnauthorized     = &apiError{http.StatusUnauthorized, "unauthorized", "unauthorized"}
+	errMissingToken     = &apiError{http.StatusUnauthorized, "missing_token", "authorization header is missing"}
+	errInvalidAuth      = &apiError{http.StatusUnauthorized, "invalid_authorization", "authorization header must be Bearer followed by a token"}
+	errInvalidToken     = &apiError{http.StatusUnauthorized, "invalid_token", "token is not valid"}
+	errExpiredToken     = &apiError{http.StatusUnauthorized, "token_expired", "token has expired"}
+	errRevokedToken     = &apiError{http.StatusUnauthorized, "token_revoked", "token was revoked"}
+	errForbidden        = &apiError{http.StatusForbidden, "forbidden", "forbidden"}
+	errEmailNotVerified = &apiError{http.StatusForbidden, "email_not_verified", "email address is not verified"}
+	errNotFound         = &apiError{http.StatusNotFound, "not_found", "not found"}
+	errUserNotFound     = &apiError{http.StatusNotFound, "user_not_found", "user not found"}
+	errMethodNotAllowed = &apiError{http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed"}
+	errValidation       = &apiError{http.StatusUnprocessableEntity, "validation_failed", "validation failed"}
+	errTooManyRequests  = &apiError{http.StatusTooManyRequests, "rate_limited", "too many requests"}
+	errInternal         = &apiError{http.StatusInternalServerError, "internal_error", "internal server error"}
+)
+
+// statusErrors are used for plain errors, by the status they are sent with.
+var statusErrors = map[int]*apiError{
+	http.StatusBadRequest:          errBadRequest,
+	http.StatusUnauthorized:        errUnauthorized,
+	http.StatusForbidden:           errForbidden,
+	http.StatusNotFound:            errNotFound,
+	http.StatusUnprocessableEntity: errValidation,
+	http.StatusTooManyRequests:     errTooManyRequests,
+	http.StatusInternalServerError: errInternal,
+}
+
+// problem is the body of error responses, as described by RFC 7807, with the
+// code, the request id and the field errors as extension members.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is an error of one field of the payload or the query.
+type fieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// writeProblem sends e as application/problem+json.
+func (app *application) writeProblem(w http.ResponseWriter, r *http.Request, e *apiError, fields validator.Errors) {
+	p := printer(r)
+
+	body := problem{
+		Type:      "about:blank",
+		Title:     p.Sprintf(http.StatusText(e.Status)),
+		Status:    e.Status,
+		Code:      e.Code,
+		Detail:    p.Sprintf(e.Detail),
+		Instance:  r.URL.Path,
+		RequestID: requestIDFromContext(r.Context()),
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, message := range fields[name] {
+			body.Errors = append(body.Errors, fieldError{Field: name, Detail: message})
+		}
+	}
+
+	out, err := json.Marshal(body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(e.Status)
+	_, _ = w.Write(out)
+}
+
+// errorJSON sends err as a problem. Errors of the api are sent as they are,
+// field errors with status 422, and any other error with status, 400 by
+// default. The message of other errors is only sent with client errors, server
+// errors are logged instead.
+func (app *application) errorJSON(w http.ResponseWriter, r *http.Request, err error, status ...int) {
+	// field errors are sent with the fields, whatever the status
+	var fields validator.Errors
+	if errors.As(err, &fields) {
+		app.validationErrorJSON(w, r, fields)
+		return
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		app.writeProblem(w, r, apiErr, nil)
+		return
+	}
+
+	statusCode := http.StatusBadRequest
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	e, ok := statusErrors[statusCode]
+	if !ok {
+		e = &apiError{Status: statusCode, Code: "error", Detail: http.StatusText(statusCode)}
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		log.Printf("request %s: %v", requestIDFromContext(r.Context()), err)
+	} else {
+		e = &apiError{Status: e.Status, Code: e.Code, Detail: err.Error()}
+	}
+
+	app.writeProblem(w, r, e, nil)
+}
+
+// validationErrorJSON sends the errors of each field, with status 422.
+func (app *application) validationErrorJSON(w http.ResponseWriter, r *http.Request, fields validator.Errors) {
+	app.writeProblem(w, r, errValidation, fields)
+}
+
+// tokenError returns err if it tells what is wrong with a token, and
+// errInvalidToken otherwise, so errors of the jwt package are not sent.
+func tokenError(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	return errInvalidToken
+}
+
+const contextRequestIDKey contextKey = "request_id"
+
+// requestIDHeader carries the id of a request, to find it in the logs.
+const requestIDHeader = "X-Request-ID"
+
+// requestID gives every request an id, and sends it back in X-Request-ID. The
+// id of the client is kept when it sends a sensible one, so requests can be
+// followed through proxies.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			var err error
+			id, err = randomID()
+			if err != nil {
+				log.Println(err)
+				id = ""
+			}
+		}
+
+		if id != "" {
+			w.Header().Set(requestIDHeader, id)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextRequestIDKey, id)))
+	})
+}
+
+// validRequestID reports whether id is short and only has letters, digits and
+// a few separators, so it is safe to log and to send back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestIDFromContext returns the id of the request, or an empty string.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextRequestIDKey).(string)
+
+	return id
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/validator"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// decodeProblem reads the problem sent to rr, and checks its content type.
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) problem {
+	t.Helper()
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("expected application/problem+json; got %q", ct)
+	}
+
+	var p problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// problemFields collects the field errors of p by field.
+func problemFields(p problem) validator.Errors {
+	fields := validator.Errors{}
+	for _, e := range p.Errors {
+		fields.Add(e.Field, e.Detail)
+	}
+
+	return fields
+}
+
+func Test_app_errorJSON(t *testing.T) {
+	var tests = []struct {
+		name           string
+		err            error
+		status         []int
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{"api-error", errUserNotFound, nil, http.StatusNotFound, "user_not_found", "user not found"},
+		{"api-error-keeps-status", errExpiredToken, []int{http.StatusBadRequest}, http.StatusUnauthorized, "token_expired", "token has expired"},
+		{"plain-error", errors.New("body must only contain a single JSON value"), nil, http.StatusBadRequest, "bad_request", "body must only contain a single JSON value"},
+		{"server-error", errors.New("pq: connection refused"), []int{http.StatusInternalServerError}, http.StatusInternalServerError, "internal_error", "internal server error"},
+		{"field-errors", validator.Errors{"limit": {"too big"}}, nil, http.StatusUnprocessableEntity, "validation_failed", "validation failed"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/users/1", nil)
+		rr := httptest.NewRecorder()
+
+		app.errorJSON(rr, req, e.err, e.status...)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		p := decodeProblem(t, rr)
+
+		if p.Status != e.expectedStatus || p.Code != e.expectedCode || p.Detail != e.expectedDetail {
+			t.Errorf("%s: wrong problem: %+v", e.name, p)
+		}
+
+		if p.Type != "about:blank" || p.Title != http.StatusText(e.expectedStatus) || p.Instance != "/users/1" {
+			t.Errorf("%s: wrong problem members: %+v", e.name, p)
+		}
+	}
+}
+
+func Test_app_validationErrorJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users", nil)
+	rr := httptest.NewRecorder()
+
+	app.validationErrorJSON(rr, req, validator.Errors{
+		"sort":  {"sort must be one of id, email"},
+		"limit": {"limit must be a number between 1 and 100", "second error"},
+	})
+
+	p := decodeProblem(t, rr)
+
+	if len(p.Errors) != 3 {
+		t.Fatalf("expected 3 field errors; got %+v", p.Errors)
+	}
+
+	// sorted by field, so the order doesn't change between requests
+	if p.Errors[0].Field != "limit" || p.Errors[1].Field != "limit" || p.Errors[2].Field != "sort" {
+		t.Errorf("wrong order of field errors: %+v", p.Errors)
+	}
+}
+
+func Test_app_authRequired_problems(t *testing.T) {
+	user := data.User{ID: 1, FirstName: "admin", LastName: "admin"}
+
+	tokens, _ := app.generateTokenPair(&user)
+	revoked, _ := app.generateTokenPair(&user)
+	claims, _ := app.parseToken(revoked.Token)
+	_ = app.Denylist.Revoke(claims.ID, claims.ExpiresAt.Time)
+
+	expired := jwt.New(app.Keys.method())
+	expired.Claims = jwt.MapClaims{
+		"sub": "1",
+		"iss": app.Domain,
+		"jti": "expired",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}
+	expiredJWT, _ := app.Keys.sign(expired)
+
+	var tests = []struct {
+		name         string
+		header       string
+		expectedCode string
+	}{
+		{"no-header", "", "missing_token"},
+		{"not-bearer", "Basic YWRtaW46c2VjcmV0", "invalid_authorization"},
+		{"garbage", "Bearer not-a-token", "invalid_token"},
+		{"refresh-token", "Bearer " + tokens.RefreshToken, "invalid_token"},
+		{"expired", "Bearer " + expiredJWT, "token_expired"},
+		{"revoked", "Bearer " + revoked.Token, "token_revoked"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/users", nil)
+		if e.header != "" {
+			req.Header.Set("Authorization", e.header)
+		}
+		rr := httptest.NewRecorder()
+
+		app.authRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401; got %d", e.name, rr.Code)
+			continue
+		}
+
+		if p := decodeProblem(t, rr); p.Code != e.expectedCode {
+			t.Errorf("%s: expected code %s; got %s", e.name, e.expectedCode, p.Code)
+		}
+	}
+}
+
+func Test_app_requestID(t *testing.T) {
+	var tests = []struct {
+		name     string
+		sent     string
+		expectID string
+	}{
+		{"generated", "", ""},
+		{"kept", "abc-123_X.y", "abc-123_X.y"},
+		{"unsafe", "abc\n123", ""},
+		{"too-long", strings.Repeat("a", 65), ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/nope", nil)
+		if e.sent != "" {
+			req.Header.Set(requestIDHeader, e.sent)
+		}
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		id := rr.Header().Get(requestIDHeader)
+		if e.expectID != "" && id != e.expectID {
+			t.Errorf("%s: expected id %q; got %q", e.name, e.expectID, id)
+		}
+		if e.expectID == "" && (id == "" || id == e.sent) {
+			t.Errorf("%s: expected a new id; got %q", e.name, id)
+		}
+
+		p := decodeProblem(t, rr)
+		if p.RequestID != id {
+			t.Errorf("%s: problem has request id %q; header has %q", e.name, p.RequestID, id)
+		}
+
+		if rr.Code != http.StatusNotFound || p.Code != "not_found" {
+			t.Errorf("%s: expected a not_found problem; got %d %s", e.name, rr.Code, p.Code)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"webapp/pkg/ratelimit"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,12 +12,27 @@ func (app *application) routes() http.Handler {
 	mux := chi.NewRouter()
 
 	// register middleware
+	mux.Use(app.requestID)
 	mux.Use(middleware.Recoverer)
 	// enable cors
+	mux.Use(app.enableCORS)
+	mux.Use(app.locale)
+
+	// unknown routes get problems too
+	mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		app.errorJSON(w, r, errNotFound)
+	})
+	mux.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		app.errorJSON(w, r, errMethodNotAllowed)
+	})
 
 	// authentication routes - auth and refresh handler
-	mux.Post("/auth", app.authenticate)
-	mux.Post("/refresh-token", app.refresh)
+	mux.With(app.rateLimit("auth", ratelimit.PerMinute(10), app.limitByIP)).Post("/auth", app.authenticate)
+	mux.With(app.rateLimit("refresh", ratelimit.PerMinute(30), app.limitByIP)).Post("/refresh-token", app.refresh)
+	mux.With(app.authRequired).Post("/logout", app.logout)
+
+	// public keys for verifying our tokens
+	mux.Get("/.well-known/jwks.json", app.jwksHandler)
 
 	// test handlers
 	mux.Get("/test", func(w http.ResponseWriter, r *http.Request) {
@@ -31,12 +47,18 @@ func (app *application) routes() http.Handler {
 
 	// protected routes
 	mux.Route("/users", func(mux chi.Router) {
+		mux.Use(app.authRequired)
 
-		mux.Get("/", app.allUsers)
-		mux.Get("/{userID}", app.getUser)
-		mux.Put("/", app.insertUser)
-		mux.Patch("/", app.updateUser)
+		// admin only
+		mux.With(app.adminOnly).Get("/", app.allUsers)
+		mux.With(app.adminOnly).Get("/search", app.searchUsers)
+		mux.With(app.adminOnly).Put("/", app.insertUser)
+		mux.With(app.adminOnly).Delete("/{userID}", app.deleteUser)
+		mux.With(app.adminOnly).Delete("/{userID}/lock", app.unlockUser)
 
+		// the user themselves or an admin
+		mux.With(app.selfOrAdmin).Get("/{userID}", app.getUser)
+		mux.With(app.selfOrAdmin).Patch("/{userID}", app.updateUser)
 	})
 
 	return mux
@@ -3,6 +3,13 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
+	"webapp/locales"
+	"webapp/pkg/denylist"
+	"webapp/pkg/i18n"
+	"webapp/pkg/lockout"
+	"webapp/pkg/mailer"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository/dbrepo"
 )
 
@@ -14,6 +21,28 @@ func TestMain(m *testing.M) {
 	app.DB = &dbrepo.TestDBRepo{}
 	app.Domain = "example.com"
 	app.JWTSecret = "teasd32safasd1zvczvckxbnz82q"
+	app.Keys = newHMACKeyRing(app.JWTSecret)
+	app.Denylist = denylist.NewMemoryStore()
+	app.Lockout = lockout.New(lockout.NewMemoryStore())
+	app.RateLimit = ratelimit.NewMemoryStore()
+	app.BaseURL = "http://localhost:8080"
+	app.VerificationKey = []byte("test-verification-key")
+	app.Mailer = &mailer.FileMailer{}
+
+	catalog, err := i18n.Load(locales.FS)
+	if err != nil {
+		panic(err)
+	}
+	app.Catalog = catalog
+	app.CORS = corsPolicy{
+		AllowedOrigins:   []string{"http://localhost:8090", "https://*.example.com"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "X-CSRF-Token", "Authorization"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+		Routes:           corsRoutes,
+	}
 
 	os.Exit(m.Run())
 }
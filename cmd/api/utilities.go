@@ -42,40 +42,36 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 	return nil
 }
 
-func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) {
-	statusCode := http.StatusBadRequest
-	if len(status) > 0 {
-		statusCode = status[0]
-	}
-
-	type jsonError struct {
-		Message string `json:"message"`
-	}
-
-	theError := jsonError{
-		Message: err.Error(),
-	}
-
-	_ = app.writeJSON(w, statusCode, theError, "error")
-}
-
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1024 * 1024 // one megabyte
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 
-	// attempt to decode the data
+	// attempt to decode the data, with the messages of the other formats
 	err := dec.Decode(data)
 	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return errMalformedBody
+		}
+		if name, ok := unknownField(err, "json"); ok {
+			return unknownFieldError(name)
+		}
 		return err
 	}
 
 	// make sure only one JSON value in payload
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
+		return errMultipleValues
 	}
 
 	return nil
 }
+
+// clientIP returns the ip address of the client that sent the request.
+// X-Forwarded-For is only believed from TrustedProxies.
+func (app *application) clientIP(r *http.Request) string {
+	return app.TrustedProxies.ClientIP(r)
+}
@@ -35,6 +35,7 @@ func main() {
 	claims["admin"] = true
 	claims["aud"] = "example.com"
 	claims["iss"] = "example.com"
+	claims["jti"] = fmt.Sprint(time.Now().UnixNano())
 	// leave this to 3 days, for easy manual testing
 	if app.Action == "valid" {
 		expires := time.Now().UTC().Add(time.Hour * 72)
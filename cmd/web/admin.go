@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"webapp/pkg/data"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminUsers lists every user.
+func (app *application) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.DB.AllUsers()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.render(w, r, "admin-users.page.gohtml", &TemplateData{Data: map[string]any{"users": users}})
+}
+
+// AdminEditUser shows the form to edit a user, and the actions admins can take.
+func (app *application) AdminEditUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	form := NewForm(url.Values{
+		"first_name": {user.FirstName},
+		"last_name":  {user.LastName},
+		"email":      {user.Email},
+	})
+
+	_ = app.render(w, r, "admin-user.page.gohtml", &TemplateData{Form: form, Data: map[string]any{"user": user}})
+}
+
+// AdminPostEditUser updates the name and email address of a user. A changed
+// address has to be verified again.
+func (app *application) AdminPostEditUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := NewForm(r.PostForm, printer(r))
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+
+	email := strings.TrimSpace(form.Data.Get("email"))
+	if form.Errors.Get("email") == "" && email != user.Email {
+		existing, err := app.DB.GetUserByEmail(email)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		form.Check(existing == nil || existing.ID == user.ID, "email", "This email address is already registered")
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = app.render(w, r, "admin-user.page.gohtml", &TemplateData{Form: form, Data: map[string]any{"user": user}})
+		return
+	}
+
+	emailChanged := email != user.Email
+
+	user.FirstName = strings.TrimSpace(form.Data.Get("first_name"))
+	user.LastName = strings.TrimSpace(form.Data.Get("last_name"))
+	user.Email = email
+
+	if err := app.DB.UpdateUser(*user); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// the new address is unverified, its owner has to confirm it
+	if emailChanged {
+		if err := app.sendEmailVerification(user); err != nil {
+			log.Println(err)
+		}
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("%s %s has been updated.", user.FirstName, user.LastName))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminToggleAdmin grants or takes away admin rights. Admins can't take away
+// their own, so there is always at least one admin left.
+func (app *application) AdminToggleAdmin(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if app.isCurrentUser(r, user) {
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("You can't remove your own admin rights."))
+		http.Redirect(w, r, adminUserURL(user), http.StatusSeeOther)
+		return
+	}
+
+	message := "%s %s is now an admin."
+	if user.IsAdmin == 1 {
+		user.IsAdmin = 0
+		message = "%s %s is no longer an admin."
+	} else {
+		user.IsAdmin = 1
+	}
+
+	if err := app.DB.UpdateUser(*user); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf(message, user.FirstName, user.LastName))
+	http.Redirect(w, r, adminUserURL(user), http.StatusSeeOther)
+}
+
+// AdminResetPassword replaces the password of a user with a random one, logs
+// them out everywhere and emails them a link to choose a new password.
+func (app *application) AdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	password, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.ResetPassword(user.ID, password); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.SessionStore.RevokeAll(user.ID); err != nil {
+		log.Println(err)
+	}
+
+	if err := app.DB.RevokeUserRefreshTokens(user.ID); err != nil {
+		log.Println(err)
+	}
+
+	mailErr := app.sendPasswordReset(user)
+	if mailErr != nil {
+		log.Println(mailErr)
+	}
+
+	if app.isCurrentUser(r, user) {
+		app.Logout(w, r)
+		return
+	}
+
+	if mailErr != nil {
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("The password has been reset, but the email could not be sent."))
+		http.Redirect(w, r, adminUserURL(user), http.StatusSeeOther)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("%s %s has been logged out and sent a link to choose a new password.", user.FirstName, user.LastName))
+	http.Redirect(w, r, adminUserURL(user), http.StatusSeeOther)
+}
+
+// AdminUnlockUser clears the failed logins of a user, so they can log in again
+// right away.
+func (app *application) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Lockout.Unlock(user.Email); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("%s %s has been unlocked.", user.FirstName, user.LastName))
+	http.Redirect(w, r, adminUserURL(user), http.StatusSeeOther)
+}
+
+// AdminDeleteUser deletes a user and logs out their sessions. Admins can't
+// delete themselves.
+func (app *application) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if app.isCurrentUser(r, user) {
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("You can't delete your own account."))
+		http.Redirect(w, r, adminUserURL(user), http.StatusSeeOther)
+		return
+	}
+
+	// the session index is removed with the user, so the sessions go first
+	if err := app.SessionStore.RevokeAll(user.ID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.DeleteUser(user.ID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("%s %s has been deleted.", user.FirstName, user.LastName))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// adminTargetUser returns the user of the userID url parameter. If there is no
+// such user, it writes the error response and returns false.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	user, err := app.DB.GetUser(id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return nil, false
+	} else if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// isCurrentUser reports whether user is the one who is logged in.
+func (app *application) isCurrentUser(r *http.Request, user *data.User) bool {
+	current, ok := app.Session.Get(r.Context(), "user").(data.User)
+
+	return ok && current.ID == user.ID
+}
+
+func adminUserURL(user *data.User) string {
+	return fmt.Sprintf("/admin/users/%d", user.ID)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"webapp/pkg/mailer"
+)
+
+// formRequest returns a request of the session with token, for the user with
+// userID. postData is sent as the form, if there is any.
+func formRequest(method, target, token, userID string, postData url.Values) *http.Request {
+	req := sessionRequest(method, target, token)
+	if postData != nil {
+		req.Body = io.NopCloser(strings.NewReader(postData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if userID != "" {
+		req = addURLParamToRequest(req, "userID", userID)
+	}
+
+	return req
+}
+
+func Test_app_adminOnly(t *testing.T) {
+	admin, _ := app.DB.GetUser(1)
+	jane, _ := app.DB.GetUser(2)
+
+	var tests = []struct {
+		name               string
+		token              string
+		expectedStatusCode int
+	}{
+		{"admin", loginSession(t, *admin, "Firefox"), http.StatusOK},
+		{"not-admin", loginSession(t, *jane, "Firefox"), http.StatusSeeOther},
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handlerToTest := app.adminOnly(nextHandler)
+
+	for _, e := range tests {
+		req := sessionRequest("GET", "/admin/users", e.token)
+		rr := httptest.NewRecorder()
+
+		handlerToTest.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_adminUsers(t *testing.T) {
+	admin, _ := app.DB.GetUser(1)
+	token := loginSession(t, *admin, "Firefox")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.AdminUsers).ServeHTTP(rr, formRequest("GET", "/admin/users", token, "", nil))
+
+	body := rr.Body.String()
+	for _, expected := range []string{"Jane Doe", "john@example.com", "Not verified", `href="/admin/users/2"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in users page", expected)
+		}
+	}
+
+	// the edit form is filled in
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.AdminEditUser).ServeHTTP(rr, formRequest("GET", "/admin/users/2", token, "2", nil))
+
+	if !strings.Contains(rr.Body.String(), `value="jane@example.com"`) {
+		t.Error("expected the email address in the edit form")
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.AdminEditUser).ServeHTTP(rr, formRequest("GET", "/admin/users/99", token, "99", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown user: expected status %d; got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func Test_app_adminPostEditUser(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	admin, _ := app.DB.GetUser(1)
+	token := loginSession(t, *admin, "Firefox")
+
+	var tests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedError      string
+		expectedMails      int
+	}{
+		{"valid", url.Values{"first_name": {"Jane"}, "last_name": {"Roe"}, "email": {"jane@example.com"}}, http.StatusSeeOther, "", 0},
+		{"new-email", url.Values{"first_name": {"Jane"}, "last_name": {"Doe"}, "email": {"jane.doe@example.com"}}, http.StatusSeeOther, "", 1},
+		{"missing-name", url.Values{"first_name": {""}, "last_name": {"Doe"}, "email": {"jane@example.com"}}, http.StatusUnprocessableEntity, "This field is required", 0},
+		{"invalid-email", url.Values{"first_name": {"Jane"}, "last_name": {"Doe"}, "email": {"jane"}}, http.StatusUnprocessableEntity, "Invalid email address", 0},
+		{"taken-email", url.Values{"first_name": {"Jane"}, "last_name": {"Doe"}, "email": {"john@example.com"}}, http.StatusUnprocessableEntity, "already registered", 0},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.AdminPostEditUser).ServeHTTP(rr, formRequest("POST", "/admin/users/2", token, "2", e.postedData))
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("%s: expected %q in the page", e.name, e.expectedError)
+		}
+
+		// a new address has to be confirmed by its owner
+		mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(mails) != e.expectedMails {
+			t.Errorf("%s: expected %d verification mails; got %d", e.name, e.expectedMails, len(mails))
+		}
+		for _, m := range mails {
+			if content, _ := os.ReadFile(m); !strings.Contains(string(content), "To: jane.doe@example.com") || !verificationLink.Match(content) {
+				t.Errorf("%s: expected a verification link for the new address; got %s", e.name, content)
+			}
+		}
+	}
+}
+
+func Test_app_adminActions(t *testing.T) {
+	admin, _ := app.DB.GetUser(1)
+	token := loginSession(t, *admin, "Firefox")
+
+	var tests = []struct {
+		name             string
+		handler          http.HandlerFunc
+		userID           string
+		expectedLocation string
+		expectedFlash    string
+		expectedError    string
+	}{
+		{"toggle-admin", app.AdminToggleAdmin, "2", "/admin/users/2", "Jane Doe is now an admin.", ""},
+		{"toggle-own-admin", app.AdminToggleAdmin, "1", "/admin/users/1", "", "You can't remove your own admin rights."},
+		{"unlock", app.AdminUnlockUser, "2", "/admin/users/2", "Jane Doe has been unlocked.", ""},
+		{"delete", app.AdminDeleteUser, "3", "/admin/users", "John Smith has been deleted.", ""},
+		{"delete-self", app.AdminDeleteUser, "1", "/admin/users/1", "", "You can't delete your own account."},
+	}
+
+	for _, e := range tests {
+		req := formRequest("POST", "/admin/users/"+e.userID, token, e.userID, url.Values{})
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %s; got %q", e.name, e.expectedLocation, loc)
+		}
+
+		if flash := app.Session.PopString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q; got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if msg := app.Session.PopString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q; got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func Test_app_adminDeleteUser_revokesSessions(t *testing.T) {
+	admin, _ := app.DB.GetUser(1)
+	john, _ := app.DB.GetUser(3)
+	token := loginSession(t, *admin, "Firefox")
+	johnToken := loginSession(t, *john, "Safari")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.AdminDeleteUser).ServeHTTP(rr, formRequest("POST", "/admin/users/3/delete", token, "3", url.Values{}))
+
+	if _, found, _ := app.SessionStore.Find(johnToken); found {
+		t.Error("session of the deleted user still exists")
+	}
+}
+
+func Test_app_adminResetPassword(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	dir := t.TempDir()
+	app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	admin, _ := app.DB.GetUser(1)
+	jane, _ := app.DB.GetUser(2)
+	token := loginSession(t, *admin, "Firefox")
+	janeToken := loginSession(t, *jane, "Safari")
+	refreshToken := issueRefreshToken(t, jane.ID)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.AdminResetPassword).ServeHTTP(rr, formRequest("POST", "/admin/users/2/reset-password", token, "2", url.Values{}))
+
+	if loc := rr.Header().Get("Location"); loc != "/admin/users/2" {
+		t.Errorf("expected redirect to /admin/users/2; got %q", loc)
+	}
+
+	if _, found, _ := app.SessionStore.Find(janeToken); found {
+		t.Error("session of the user still exists after a forced reset")
+	}
+
+	if !refreshTokenRevoked(t, refreshToken) {
+		t.Error("refresh token of the user is still valid after a forced reset")
+	}
+
+	if _, found, _ := app.SessionStore.Find(token); !found {
+		t.Error("session of the admin was revoked")
+	}
+
+	mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(mails) != 1 {
+		t.Errorf("expected 1 reset mail; got %d", len(mails))
+	}
+}
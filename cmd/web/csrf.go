@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"mime"
+	"net/http"
+)
+
+const (
+	csrfSessionKey = "csrf_token"
+	csrfFormField  = "csrf_token"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+// csrfToken returns the synchronizer token of the session, creating it on first use.
+func (app *application) csrfToken(ctx context.Context) string {
+	if token := app.Session.GetString(ctx, csrfSessionKey); token != "" {
+		return token
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	app.Session.Put(ctx, csrfSessionKey, token)
+
+	return token
+}
+
+// renewCSRFToken replaces the token of the session, like when the user logs in.
+func (app *application) renewCSRFToken(ctx context.Context) {
+	app.Session.Remove(ctx, csrfSessionKey)
+}
+
+// csrf rejects requests that change state, unless they carry the token of the
+// session in the csrf_token form field or the X-CSRF-Token header.
+func (app *application) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected := app.Session.GetString(r.Context(), csrfSessionKey)
+
+		sent := r.Header.Get(csrfHeader)
+		if sent == "" {
+			if err := parseForm(r); err != nil {
+				log.Println(err)
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			sent = r.PostForm.Get(csrfFormField)
+		}
+
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(sent)) != 1 {
+			w.WriteHeader(http.StatusForbidden)
+			_ = app.render(w, r, "csrf.page.gohtml", &TemplateData{})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseForm reads the form of r, multipart forms like uploads too. The body is
+// capped by limitBody, so it is never read past maxUploadSize.
+func parseForm(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return r.ParseMultipartForm(maxUploadFileSize)
+	}
+
+	return r.ParseForm()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_csrf(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name         string
+		method       string
+		formToken    string
+		headerToken  string
+		useSession   bool
+		expectedCode int
+	}{
+		{"get", "GET", "", "", false, http.StatusOK},
+		{"post-form-token", "POST", "session", "", true, http.StatusOK},
+		{"post-header-token", "POST", "", "session", true, http.StatusOK},
+		{"post-no-token", "POST", "", "", true, http.StatusForbidden},
+		{"post-wrong-token", "POST", "wrong", "", true, http.StatusForbidden},
+		{"post-no-session-token", "POST", "", "", false, http.StatusForbidden},
+		{"delete-wrong-header", "DELETE", "", "wrong", true, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/", nil)
+		req = addContextAndSessionToRequest(req, app)
+
+		var token string
+		if e.useSession {
+			token = app.csrfToken(req.Context())
+		}
+
+		postData := url.Values{}
+		if e.formToken == "session" {
+			postData.Set(csrfFormField, token)
+		} else if e.formToken != "" {
+			postData.Set(csrfFormField, e.formToken)
+		}
+		req.Body = io.NopCloser(strings.NewReader(postData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if e.headerToken == "session" {
+			req.Header.Set(csrfHeader, token)
+		} else if e.headerToken != "" {
+			req.Header.Set(csrfHeader, e.headerToken)
+		}
+
+		rr := httptest.NewRecorder()
+		app.csrf(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedCode == http.StatusForbidden && !strings.Contains(rr.Body.String(), "This form has expired") {
+			t.Errorf("%s: expected the csrf error page", e.name)
+		}
+	}
+}
+
+func Test_app_csrf_multipart(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/user/upload-profile-pic", nil)
+	req = addContextAndSessionToRequest(req, app)
+	token := app.csrfToken(req.Context())
+
+	// the token comes after the file, like in the upload form
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	w, _ := mw.CreateFormFile("image", "me.png")
+	_, _ = w.Write([]byte("image"))
+	_ = mw.WriteField(csrfFormField, token)
+	mw.Close()
+	req.Body = io.NopCloser(body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var passed bool
+	rr := httptest.NewRecorder()
+	app.csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passed = r.MultipartForm != nil && len(r.MultipartForm.File["image"]) == 1
+	})).ServeHTTP(rr, req)
+
+	if !passed {
+		t.Errorf("expected the upload to pass with its file; got status %d", rr.Code)
+	}
+}
+
+func Test_app_renderCSRFToken(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(app.Home).ServeHTTP(rr, req)
+
+	token := app.Session.GetString(req.Context(), csrfSessionKey)
+	if token == "" {
+		t.Fatal("no csrf token stored in the session")
+	}
+
+	if !strings.Contains(rr.Body.String(), `name="csrf_token" value="`+token+`"`) {
+		t.Error("csrf token is not embedded in the login form")
+	}
+
+	// logging in gives the session a new token
+	app.renewCSRFToken(req.Context())
+	if app.csrfToken(req.Context()) == token {
+		t.Error("csrf token was not renewed")
+	}
+}
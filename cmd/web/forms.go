@@ -1,36 +1,66 @@
 package main
 
 import (
+	"net/mail"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"webapp/pkg/i18n"
+	"webapp/pkg/validator"
 )
 
-type errors map[string][]string
+// errors holds the error messages of each field. It is the type the validator
+// package reports struct errors with, so they are shown the same way.
+type errors = validator.Errors
 
-func (e errors) Get(field string) string {
-	errorSlice := e[field]
+type Form struct {
+	Data   url.Values
+	Errors errors
+	// Messages replaces the default error messages of the validators, by rule
+	// like "required", or by field and rule like "email.required".
+	Messages map[string]string
+	// Printer translates the error messages, they stay English when it is nil.
+	Printer *i18n.Printer
+}
 
-	if len(errorSlice) == 0 {
-		return ""
+// NewForm returns a form for data. The optional printer translates its error
+// messages, usually printer(r) for the language of the request.
+func NewForm(data url.Values, printer ...*i18n.Printer) *Form {
+	f := &Form{
+		Data:     data,
+		Errors:   map[string][]string{},
+		Messages: map[string]string{},
 	}
 
-	return errorSlice[0]
-}
+	if len(printer) > 0 {
+		f.Printer = printer[0]
+	}
 
-func (e errors) Add(field, message string) {
-	e[field] = append(e[field], message)
+	return f
 }
 
-type Form struct {
-	Data   url.Values
-	Errors errors
+// Value returns the submitted value of field, to fill in the form again.
+func (f *Form) Value(field string) string {
+	if f == nil {
+		return ""
+	}
+
+	return f.Data.Get(field)
 }
 
-func NewForm(data url.Values) *Form {
-	return &Form{
-		Data:   data,
-		Errors: map[string][]string{},
+// fail adds the error of rule to field, with the message from Messages if
+// there is one, or else the default message. The message is translated, and
+// formatted with args.
+func (f *Form) fail(field, rule, format string, args ...any) {
+	if m, ok := f.Messages[field+"."+rule]; ok {
+		format = m
+	} else if m, ok := f.Messages[rule]; ok {
+		format = m
 	}
+
+	f.Errors.Add(field, f.Printer.Sprintf(format, args...))
 }
 
 func (f *Form) Has(field string) bool {
@@ -48,17 +78,159 @@ func (f *Form) Required(fields ...string) {
 		value := f.Data.Get(field)
 
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field is required")
+			f.fail(field, "required", "This field is required")
 		}
 	}
 }
 
 func (f *Form) Check(ok bool, key, message string) {
 	if !ok {
-		f.Errors.Add(key, message)
+		f.Errors.Add(key, f.Printer.Sprintf(message))
 	}
 }
 
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
 }
+
+// IsEmail checks that field holds a single, plain email address.
+func (f *Form) IsEmail(field string) {
+	value := strings.TrimSpace(f.Data.Get(field))
+	if value == "" {
+		return
+	}
+
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		f.fail(field, "email", "Invalid email address")
+	}
+}
+
+// MinLength checks that field is at least length characters long.
+func (f *Form) MinLength(field string, length int) {
+	value := f.Data.Get(field)
+	if value == "" {
+		return
+	}
+
+	if len([]rune(value)) < length {
+		f.fail(field, "minlength", "This field must be at least %d characters long", length)
+	}
+}
+
+// MaxLength checks that field is at most length characters long.
+func (f *Form) MaxLength(field string, length int) {
+	if len([]rune(f.Data.Get(field))) > length {
+		f.fail(field, "maxlength", "This field must be at most %d characters long", length)
+	}
+}
+
+// Matches checks that field matches pattern.
+func (f *Form) Matches(field string, pattern *regexp.Regexp) {
+	value := f.Data.Get(field)
+	if value == "" {
+		return
+	}
+
+	if !pattern.MatchString(value) {
+		f.fail(field, "matches", "This field has an invalid format")
+	}
+}
+
+// IsInt checks that field holds a whole number.
+func (f *Form) IsInt(field string) {
+	value := strings.TrimSpace(f.Data.Get(field))
+	if value == "" {
+		return
+	}
+
+	if _, err := strconv.Atoi(value); err != nil {
+		f.fail(field, "int", "This field must be a whole number")
+	}
+}
+
+// In checks that field holds one of values, like the options of a select.
+func (f *Form) In(field string, values ...string) {
+	value := f.Data.Get(field)
+	if value == "" {
+		return
+	}
+
+	for _, v := range values {
+		if value == v {
+			return
+		}
+	}
+
+	f.fail(field, "in", "This field must be one of: %s", strings.Join(values, ", "))
+}
+
+// IsDate checks that field holds a date in layout, like "2006-01-02".
+func (f *Form) IsDate(field, layout string) {
+	value := strings.TrimSpace(f.Data.Get(field))
+	if value == "" {
+		return
+	}
+
+	if _, err := time.Parse(layout, value); err != nil {
+		f.fail(field, "date", "This field must be a date like %s", layout)
+	}
+}
+
+// IsURL checks that field holds an absolute http or https url.
+func (f *Form) IsURL(field string) {
+	value := strings.TrimSpace(f.Data.Get(field))
+	if value == "" {
+		return
+	}
+
+	u, err := url.ParseRequestURI(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		f.fail(field, "url", "This field must be a http or https url")
+	}
+}
+
+// EqualFields checks that field has the same value as other, like a password
+// and its confirmation.
+func (f *Form) EqualFields(field, other string) {
+	if f.Data.Get(field) != f.Data.Get(other) {
+		f.fail(other, "equal", "The values do not match")
+	}
+}
+
+// StrongPassword checks that field holds a password of at least minLength
+// characters, with at least one letter and one digit.
+func (f *Form) StrongPassword(field string, minLength int) {
+	value := f.Data.Get(field)
+	if value == "" {
+		return
+	}
+
+	if !validator.IsStrongPassword(value, minLength) {
+		f.fail(field, "password", "Password must be at least %d characters long and contain letters and digits", minLength)
+	}
+}
+
+// Bind copies the submitted values into dst, a pointer to a struct with form
+// tags. Values that can't be converted are added as errors.
+func (f *Form) Bind(dst any) {
+	for field, messages := range validator.Bind(f.Data, dst) {
+		for _, message := range messages {
+			f.Errors.Add(field, f.Printer.Sprintf(message))
+		}
+	}
+}
+
+// Validate checks v, a struct with validate tags, and adds its errors to the
+// form. Messages replaces the default messages, like for the other checks.
+func (f *Form) Validate(v any) {
+	f.merge(validator.Validator{Messages: f.Messages, Translate: f.Printer.Sprintf}.Struct(v))
+}
+
+func (f *Form) merge(errs validator.Errors) {
+	for field, messages := range errs {
+		for _, message := range messages {
+			f.Errors.Add(field, message)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
 	"testing"
 )
 
@@ -72,3 +73,202 @@ func TestForm_ErrorGet(t *testing.T) {
 		t.Error("should not have an error, got one")
 	}
 }
+
+func TestForm_IsEmail(t *testing.T) {
+	var tests = []struct {
+		name          string
+		email         string
+		errorExpected bool
+	}{
+		{"valid", "jack@example.com", false},
+		{"empty", "", false},
+		{"no-at", "jack.example.com", true},
+		{"with-name", "Jack <jack@example.com>", true},
+	}
+
+	for _, e := range tests {
+		form := NewForm(url.Values{"email": {e.email}})
+		form.IsEmail("email")
+
+		if form.Valid() == e.errorExpected {
+			t.Errorf("%s: expected error %v; got %q", e.name, e.errorExpected, form.Errors.Get("email"))
+		}
+	}
+}
+
+func TestForm_MinLength(t *testing.T) {
+	form := NewForm(url.Values{"a": {"abc"}, "b": {"ab"}})
+
+	form.MinLength("a", 3)
+	if !form.Valid() {
+		t.Error("form shows invalid when field is long enough")
+	}
+
+	form.MinLength("b", 3)
+	if form.Errors.Get("b") == "" {
+		t.Error("form shows valid when field is too short")
+	}
+}
+
+func TestForm_EqualFields(t *testing.T) {
+	form := NewForm(url.Values{"password": {"secret123"}, "confirm_password": {"secret123"}})
+
+	form.EqualFields("password", "confirm_password")
+	if !form.Valid() {
+		t.Error("form shows invalid when fields are equal")
+	}
+
+	form = NewForm(url.Values{"password": {"secret123"}, "confirm_password": {"secret124"}})
+	form.EqualFields("password", "confirm_password")
+	if form.Errors.Get("confirm_password") == "" {
+		t.Error("expected an error on confirm_password, got none")
+	}
+}
+
+func TestForm_StrongPassword(t *testing.T) {
+	var tests = []struct {
+		name          string
+		password      string
+		errorExpected bool
+	}{
+		{"strong", "secret123", false},
+		{"too-short", "sec123", true},
+		{"no-digits", "secretsecret", true},
+		{"no-letters", "1234567890", true},
+	}
+
+	for _, e := range tests {
+		form := NewForm(url.Values{"password": {e.password}})
+		form.StrongPassword("password", 8)
+
+		if form.Valid() == e.errorExpected {
+			t.Errorf("%s: expected error %v; got %q", e.name, e.errorExpected, form.Errors.Get("password"))
+		}
+	}
+}
+
+func TestForm_MaxLength(t *testing.T) {
+	form := NewForm(url.Values{"a": {"abc"}, "b": {"abcd"}, "c": {"äöü"}})
+
+	form.MaxLength("a", 3)
+	form.MaxLength("c", 3)
+	if !form.Valid() {
+		t.Errorf("form shows invalid when fields are short enough: %v", form.Errors)
+	}
+
+	form.MaxLength("b", 3)
+	if form.Errors.Get("b") == "" {
+		t.Error("form shows valid when field is too long")
+	}
+}
+
+func TestForm_validators(t *testing.T) {
+	zip := regexp.MustCompile(`^\d{5}$`)
+
+	var tests = []struct {
+		name          string
+		value         string
+		check         func(f *Form)
+		errorExpected bool
+	}{
+		{"matches", "12345", func(f *Form) { f.Matches("v", zip) }, false},
+		{"matches-invalid", "1234a", func(f *Form) { f.Matches("v", zip) }, true},
+		{"int", "-42", func(f *Form) { f.IsInt("v") }, false},
+		{"int-invalid", "4.2", func(f *Form) { f.IsInt("v") }, true},
+		{"in", "green", func(f *Form) { f.In("v", "red", "green") }, false},
+		{"in-invalid", "blue", func(f *Form) { f.In("v", "red", "green") }, true},
+		{"date", "2022-03-17", func(f *Form) { f.IsDate("v", "2006-01-02") }, false},
+		{"date-invalid", "2022-02-30", func(f *Form) { f.IsDate("v", "2006-01-02") }, true},
+		{"url", "https://example.com/a?b=c", func(f *Form) { f.IsURL("v") }, false},
+		{"url-relative", "/a/b", func(f *Form) { f.IsURL("v") }, true},
+		{"url-scheme", "javascript:alert(1)", func(f *Form) { f.IsURL("v") }, true},
+		{"url-no-host", "http://", func(f *Form) { f.IsURL("v") }, true},
+		// empty fields are left to Required
+		{"empty", "", func(f *Form) {
+			f.Matches("v", zip)
+			f.IsInt("v")
+			f.In("v", "red")
+			f.IsDate("v", "2006-01-02")
+			f.IsURL("v")
+		}, false},
+	}
+
+	for _, e := range tests {
+		form := NewForm(url.Values{"v": {e.value}})
+		e.check(form)
+
+		if form.Valid() == e.errorExpected {
+			t.Errorf("%s: expected error %v; got %q", e.name, e.errorExpected, form.Errors.Get("v"))
+		}
+	}
+}
+
+func TestForm_Messages(t *testing.T) {
+	form := NewForm(url.Values{})
+	form.Messages["required"] = "Please fill this in"
+	form.Messages["email.required"] = "We need your email address"
+
+	form.Required("name", "email")
+
+	if got := form.Errors.Get("name"); got != "Please fill this in" {
+		t.Errorf("expected the message of the rule; got %q", got)
+	}
+
+	if got := form.Errors.Get("email"); got != "We need your email address" {
+		t.Errorf("expected the message of the field; got %q", got)
+	}
+
+	form = NewForm(url.Values{"age": {"ten"}})
+	form.IsInt("age")
+	if got := form.Errors.Get("age"); got != "This field must be a whole number" {
+		t.Errorf("expected the default message; got %q", got)
+	}
+}
+
+func TestForm_templateHelpers(t *testing.T) {
+	form := NewForm(url.Values{"email": {"jane@example.com"}})
+	form.Errors.Add("email", "first")
+	form.Errors.Add("email", "second")
+
+	if form.Value("email") != "jane@example.com" || form.Value("missing") != "" {
+		t.Error("wrong values")
+	}
+
+	if !form.Errors.Has("email") || form.Errors.Has("name") {
+		t.Error("wrong result of Has")
+	}
+
+	if all := form.Errors.All("email"); len(all) != 2 || all[1] != "second" {
+		t.Errorf("expected both errors; got %v", all)
+	}
+
+	var empty *Form
+	if empty.Value("email") != "" {
+		t.Error("expected an empty value for a nil form")
+	}
+}
+
+func TestForm_BindValidate(t *testing.T) {
+	var input struct {
+		Email string `form:"email" validate:"required,email"`
+		Age   int    `form:"age" validate:"min=18"`
+	}
+
+	form := NewForm(url.Values{"email": {"jane"}, "age": {"ten"}})
+	form.Messages["email.email"] = "That is not an email address"
+
+	form.Bind(&input)
+	form.Validate(&input)
+
+	if input.Email != "jane" {
+		t.Errorf("expected the email to be bound; got %q", input.Email)
+	}
+
+	if got := form.Errors.Get("email"); got != "That is not an email address" {
+		t.Errorf("expected the custom message; got %q", got)
+	}
+
+	if !form.Errors.Has("age") {
+		t.Error("expected an error for an age that is not a number")
+	}
+}
@@ -1,21 +1,21 @@
 package main
 
 import (
-	"fmt"
-	"html/template"
-	"io"
+	"database/sql"
+	stderrors "errors"
 	"log"
 	"net/http"
 	"os"
-	"path"
-	"path/filepath"
+	"strings"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/lockout"
 )
 
-var pathTpTemplates = "./templates/"
 var uploadPath = "./static/img"
 
+const minPasswordLength = 8
+
 func (app *application) Home(w http.ResponseWriter, r *http.Request) {
 	var td = make(map[string]any)
 
@@ -34,23 +34,22 @@ func (app *application) Profile(w http.ResponseWriter, r *http.Request) {
 }
 
 type TemplateData struct {
-	IP    string
-	Data  map[string]any
-	Error string
-	Flash string
-	User  data.User
+	IP        string
+	Data      map[string]any
+	Error     string
+	Flash     string
+	User      data.User
+	Form      *Form
+	CSRFToken string
+	// Lang is the language the page is rendered in, Languages the ones it can
+	// be switched to.
+	Lang      string
+	Languages []localeOption
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, t string, td *TemplateData) error {
-	// parse template from disk
-	parsedTemplate, err := template.ParseFiles(path.Join(pathTpTemplates, t), path.Join(pathTpTemplates, "base.layout.gohtml"))
-	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
-
-		return err
-	}
-
-	td.IP = app.ipFromContext(r.Context())
+	td.IP = app.clientIP(r)
+	td.CSRFToken = app.csrfToken(r.Context())
 
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Flash = app.Session.PopString(r.Context(), "flash")
@@ -59,9 +58,14 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, t string,
 		td.User = app.Session.Get(r.Context(), "user").(data.User)
 	}
 
+	td.Lang = printer(r).Tag().String()
+	td.Languages = app.languages()
+
 	// execute template, pass date ..
-	err = parsedTemplate.Execute(w, td)
+	err := app.Templates.execute(w, t, printer(r).Tag(), td)
 	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+
 		return err
 	}
 
@@ -77,22 +81,34 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// validate data
-	form := NewForm(r.PostForm)
+	form := NewForm(r.PostForm, printer(r))
 	form.Required("email", "password")
 
 	if !form.Valid() {
 		// redirect to login page with error message
-		app.Session.Put(r.Context(), "error", "Invalid login credentials")
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("Invalid login credentials"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
+	ip := app.clientIP(r)
+
+	// don't even check the password while the account or ip is locked
+	if _, err := app.Lockout.Check(email, ip); err != nil {
+		if !stderrors.Is(err, lockout.ErrLocked) {
+			log.Println(err)
+		}
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("Invalid login!"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
 	user, err := app.DB.GetUserByEmail(email)
 	if err != nil {
-		app.Session.Put(r.Context(), "error", "Invalid login!")
+		app.loginFailed(email, ip)
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("Invalid login!"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -100,118 +116,179 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	// authenticate user
 	// if not authenticated then redirect with error
 	if !app.authenticate(r, user, password) {
-		app.Session.Put(r.Context(), "error", "Invalid login!")
+		app.loginFailed(email, ip)
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("Invalid login!"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	if err := app.Lockout.Succeed(email); err != nil {
+		log.Println(err)
+	}
+
 	// prevent fixation attack
 	_ = app.Session.RenewToken(r.Context())
+	app.renewCSRFToken(r.Context())
+	app.indexSession(r, *user)
 
 	// store success message in session
 	// redirect to other page
-	app.Session.Put(r.Context(), "flash", "Successfully logged in!")
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Successfully logged in!"))
 	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
 }
 
+// loginFailed counts a failed login against the account and the ip.
+func (app *application) loginFailed(email, ip string) {
+	if err := app.Lockout.Fail(email, ip); err != nil {
+		log.Println(err)
+	}
+}
+
 func (app *application) authenticate(r *http.Request, user *data.User, password string) bool {
 	if valid, err := user.PasswordMatches(password); err != nil || !valid {
 		return false
 	}
 
-	app.Session.Put(r.Context(), "user", user)
+	app.Session.Put(r.Context(), "user", *user)
 
 	return true
 }
 
-func (app *application) UploadProfilePic(w http.ResponseWriter, r *http.Request) {
-	// call a function that extracts a file from a request
-	files, err := app.uploadFiles(r, uploadPath)
+func (app *application) Register(w http.ResponseWriter, r *http.Request) {
+	_ = app.render(w, r, "register.page.gohtml", &TemplateData{Form: NewForm(nil)})
+}
+
+// registerInput is the form posted to create an account.
+type registerInput struct {
+	FirstName       string `form:"first_name" validate:"required,max=255"`
+	LastName        string `form:"last_name" validate:"required,max=255"`
+	Email           string `form:"email" validate:"required,email,max=255"`
+	Password        string `form:"password" validate:"required,password=8"`
+	ConfirmPassword string `form:"confirm_password" validate:"required,eqfield=Password"`
+}
+
+func (app *application) PostRegister(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
-	// get the user from session
-	user := app.Session.Get(r.Context(), "user").(data.User)
-
-	// create a variable type data.UserImage
-	var i = data.UserImage{
-		UserID:   user.ID,
-		FileName: files[0].OriginalFileName,
+	// validate data
+	var input registerInput
+	form := NewForm(r.PostForm, printer(r))
+	form.Bind(&input)
+	form.Validate(&input)
+
+	email := strings.TrimSpace(input.Email)
+
+	if form.Valid() {
+		_, err := app.DB.GetUserByEmail(email)
+		switch {
+		case err == nil:
+			form.Errors.Add("email", printer(r).Sprintf("This email address is already registered"))
+		case err != sql.ErrNoRows:
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	// insert user image into user_images
-	_, err = app.DB.InsertUserImage(i)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !form.Valid() {
+		// show the form again, with the errors and what was typed in
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = app.render(w, r, "register.page.gohtml", &TemplateData{Form: form})
 		return
 	}
 
-	// refresh the session variable `user`
-	updatedUser, err := app.DB.GetUser(user.ID)
+	user := data.User{
+		FirstName: strings.TrimSpace(input.FirstName),
+		LastName:  strings.TrimSpace(input.LastName),
+		Email:     email,
+		Password:  input.Password,
+	}
+
+	user.ID, err = app.DB.InsertUser(user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	app.Session.Put(r.Context(), "user", updatedUser)
+	user.Password = ""
 
-	// redirect back to profile page
-	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
-}
+	// prevent fixation attack
+	_ = app.Session.RenewToken(r.Context())
+	app.renewCSRFToken(r.Context())
 
-type UploadedFile struct {
-	OriginalFileName string
-	FileSize         int64
-}
+	if err := app.sendEmailVerification(&user); err != nil {
+		log.Println(err)
+	}
 
-func (app *application) uploadFiles(r *http.Request, uploadDir string) ([]*UploadedFile, error) {
-	var uploadedFiles []*UploadedFile
+	app.Session.Put(r.Context(), "user", user)
+	app.indexSession(r, user)
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Welcome, your account has been created! Please confirm your email address."))
+	http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+}
 
-	// 5 Mg
-	err := r.ParseMultipartForm(int64(1024 * 1024 * 5))
+func (app *application) UploadProfilePic(w http.ResponseWriter, r *http.Request) {
+	// uploads are kept out of uploadPath, which is served, until they are processed
+	tempDir, err := os.MkdirTemp("", "upload-")
 	if err != nil {
-		return nil, fmt.Errorf("uploaded file is too big, must be less than %d bytes", 1024*1024*5)
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
 	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
 
-	for _, fHeaders := range r.MultipartForm.File {
-		for _, hdr := range fHeaders {
-
-			uploadedFiles, err = func(UploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-
-				var uploadedFile UploadedFile
-				infile, err := hdr.Open()
-				if err != nil {
-					return nil, err
-				}
-				defer infile.Close()
-
-				uploadedFile.OriginalFileName = hdr.Filename
+	// call a function that extracts a file from a request
+	files, err := app.uploadFiles(r, tempDir)
+	if err == nil && len(files) != 1 {
+		err = uploadErrorf("Choose one image to upload")
+	}
 
-				var outfile *os.File
-				defer outfile.Close()
+	// serve a processed copy, never the upload itself
+	var pic *data.UserImage
+	if err == nil {
+		pic, err = processProfilePic(tempDir, uploadPath, files[0])
+	}
 
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.OriginalFileName)); err != nil {
-					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
+	if uerr, ok := err.(*uploadError); ok {
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf(uerr.format, uerr.args...))
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
-					uploadedFile.FileSize = fileSize
-				}
+	// get the user from session
+	user := app.Session.Get(r.Context(), "user").(data.User)
+	pic.UserID = user.ID
 
-				uploadedFiles = append(uploadedFiles, &uploadedFile)
+	// the picture that is replaced, its files are removed once it is
+	var old data.UserImage
+	if current, err := app.DB.GetUser(user.ID); err == nil {
+		old = current.ProfilePic
+	}
 
-				return uploadedFiles, nil
-			}(uploadedFiles)
+	// insert user image into user_images, with its variants
+	_, err = app.DB.InsertUserImage(*pic)
+	if err != nil {
+		removeProfilePic(uploadPath, pic)
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	removeProfilePic(uploadPath, &old)
 
-			if err != nil {
-				return uploadedFiles, err
-			}
-		}
+	// refresh the session variable `user`
+	if err := app.refreshSessionUser(r, user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	return uploadedFiles, nil
+	// redirect back to profile page
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
 }
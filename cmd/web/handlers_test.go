@@ -2,9 +2,7 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"crypto/tls"
-	"fmt"
 	"image"
 	"image/png"
 	"io"
@@ -14,10 +12,13 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"webapp/pkg/data"
+	"webapp/pkg/lockout"
+	"webapp/pkg/sessionstore"
 )
 
 func Test_application_handlers(t *testing.T) {
@@ -77,20 +78,21 @@ func Test_application_handlers(t *testing.T) {
 }
 
 func TestApp_renderBadTemplate(t *testing.T) {
-	// set invalid template path
-	pathTpTemplates = "./testdata/"
+	// templates that don't parse are rejected up front
+	_, err := newTemplateCache(os.DirFS("./testdata"), nil, false)
+	if err == nil {
+		t.Error("expected error from bad template, not get any")
+	}
 
 	req, _ := http.NewRequest("GET", "/", nil)
 	req = addContextAndSessionToRequest(req, app)
 	rr := httptest.NewRecorder()
 
-	err := app.render(rr, req, "bad.page.gohtml", &TemplateData{})
+	err = app.render(rr, req, "missing.page.gohtml", &TemplateData{})
 
 	if err == nil {
-		t.Error("expected error from bad template, not get any")
+		t.Error("expected error from missing template, not get any")
 	}
-
-	pathTpTemplates = "./../../templates"
 }
 
 func TestApplication_Home(t *testing.T) {
@@ -129,14 +131,7 @@ func TestApplication_Home(t *testing.T) {
 	}
 }
 
-func getCtx(req *http.Request) context.Context {
-	ctx := context.WithValue(req.Context(), contextUserKey, "unknown")
-
-	return ctx
-}
-
 func addContextAndSessionToRequest(req *http.Request, app application) *http.Request {
-	req = req.WithContext(getCtx(req))
 	ctx, _ := app.Session.Load(req.Context(), req.Header.Get("X-Session"))
 
 	return req.WithContext(ctx)
@@ -174,6 +169,180 @@ func Test_app_login(t *testing.T) {
 	}
 }
 
+func Test_app_login_lockout(t *testing.T) {
+	oldLockout := app.Lockout
+	defer func() { app.Lockout = oldLockout }()
+
+	app.Lockout = lockout.New(lockout.NewMemoryStore())
+	app.Lockout.AccountPolicy.MaxFailures = 2
+
+	login := func(password string) string {
+		postData := url.Values{
+			"email":    {"admin@example.com"},
+			"password": {password},
+		}
+		req, _ := http.NewRequest("POST", "/login", strings.NewReader(postData.Encode()))
+		req = addContextAndSessionToRequest(req, app)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(app.Login).ServeHTTP(rr, req)
+
+		return rr.Header().Get("Location")
+	}
+
+	login("invalid")
+	login("invalid")
+
+	if loc := login("secret"); loc != "/" {
+		t.Errorf("locked account: expected redirect to /; got %s", loc)
+	}
+
+	_ = app.Lockout.Unlock("admin@example.com")
+
+	if loc := login("secret"); loc != "/user/profile" {
+		t.Errorf("unlocked account: expected redirect to /user/profile; got %s", loc)
+	}
+}
+
+func Test_app_login_lockout_spoofedIP(t *testing.T) {
+	oldLockout := app.Lockout
+	defer func() { app.Lockout = oldLockout }()
+
+	app.Lockout = lockout.New(lockout.NewMemoryStore())
+	app.Lockout.IPPolicy.MaxFailures = 2
+
+	login := func(email, password, forwardedFor string) string {
+		postData := url.Values{
+			"email":    {email},
+			"password": {password},
+		}
+		req, _ := http.NewRequest("POST", "/login", strings.NewReader(postData.Encode()))
+		req = addContextAndSessionToRequest(req, app)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(app.Login).ServeHTTP(rr, req)
+
+		return rr.Header().Get("Location")
+	}
+
+	// a new forwarded address for every attempt doesn't help
+	login("a@example.com", "invalid", "203.0.113.1")
+	login("b@example.com", "invalid", "203.0.113.2")
+
+	if loc := login("admin@example.com", "secret", "203.0.113.3"); loc != "/" {
+		t.Errorf("locked ip: expected redirect to /; got %s", loc)
+	}
+}
+
+func Test_app_register(t *testing.T) {
+	validData := func() url.Values {
+		return url.Values{
+			"first_name":       {"Jack"},
+			"last_name":        {"Smith"},
+			"email":            {"jack@example.com"},
+			"password":         {"secret123"},
+			"confirm_password": {"secret123"},
+		}
+	}
+
+	var tests = []struct {
+		name               string
+		change             func(url.Values)
+		expectedStatusCode int
+		expectedLoc        string
+		expectedHtml       string
+	}{
+		{"valid", func(v url.Values) {}, http.StatusSeeOther, "/verify-email", ""},
+		{"missing-name", func(v url.Values) { v.Del("first_name") }, http.StatusUnprocessableEntity, "", "This field is required"},
+		{"invalid-email", func(v url.Values) { v.Set("email", "jack") }, http.StatusUnprocessableEntity, "", "Invalid email address"},
+		{"weak-password", func(v url.Values) { v.Set("password", "secret"); v.Set("confirm_password", "secret") }, http.StatusUnprocessableEntity, "", "Password must be at least 8 characters"},
+		{"wrong-confirmation", func(v url.Values) { v.Set("confirm_password", "secret124") }, http.StatusUnprocessableEntity, "", "The values do not match"},
+		{"email-taken", func(v url.Values) { v.Set("email", "admin@example.com") }, http.StatusUnprocessableEntity, "", "already registered"},
+	}
+
+	for _, e := range tests {
+		postData := validData()
+		e.change(postData)
+
+		req, _ := http.NewRequest("POST", "/register", strings.NewReader(postData.Encode()))
+		req = addContextAndSessionToRequest(req, app)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(app.PostRegister).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: returned wrong status code, expected %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected redirect to %q; got %q", e.name, e.expectedLoc, loc)
+		}
+
+		if e.expectedHtml != "" && !strings.Contains(rr.Body.String(), e.expectedHtml) {
+			t.Errorf("%s: did not find %q in response body", e.name, e.expectedHtml)
+		}
+
+		if e.expectedStatusCode == http.StatusSeeOther {
+			user, ok := app.Session.Get(req.Context(), "user").(data.User)
+			if !ok || user.Email != "jack@example.com" || user.Password != "" {
+				t.Errorf("%s: expected the new user to be logged in; got %+v", e.name, user)
+			}
+		}
+	}
+}
+
+func Test_app_login_indexesSession(t *testing.T) {
+	var tests = []struct {
+		name     string
+		handler  http.HandlerFunc
+		postData url.Values
+		userID   int
+	}{
+		{"login", app.Login, url.Values{"email": {"admin@example.com"}, "password": {"secret"}}, 1},
+		{"register", app.PostRegister, url.Values{
+			"first_name":       {"Jack"},
+			"last_name":        {"Smith"},
+			"email":            {"jack@example.com"},
+			"password":         {"secret123"},
+			"confirm_password": {"secret123"},
+		}, 2},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(e.postData.Encode()))
+		req = addContextAndSessionToRequest(req, app)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", "Opera")
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		// the new session is indexed before it makes another request
+		token := app.Session.Token(req.Context())
+		indexed := false
+		sessions, _ := app.SessionStore.List(e.userID)
+		for _, s := range sessions {
+			indexed = indexed || (s.ID == sessionstore.ID(token) && s.UserAgent == "Opera")
+		}
+		if !indexed {
+			t.Errorf("%s: the new session is not in the index", e.name)
+		}
+
+		// so logging out everywhere includes it
+		if err := app.SessionStore.RevokeAll(e.userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, found, _ := app.SessionStore.Find(token); found {
+			t.Errorf("%s: the new session survived revoking every session", e.name)
+		}
+	}
+}
+
 func Test_app_UploadFiles(t *testing.T) {
 	// set up pipes
 	pr, pw := io.Pipe()
@@ -193,18 +362,20 @@ func Test_app_UploadFiles(t *testing.T) {
 	request.Header.Add("Content-Type", writer.FormDataContentType())
 
 	// call app.UploadFiles
-	uploadedFiles, err := app.uploadFiles(request, "./testdata/uploads/")
+	uploadDir := t.TempDir()
+	uploadedFiles, err := app.uploadFiles(request, uploadDir)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	// perform tests
-	if _, err := os.Stat(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].OriginalFileName)); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(uploadDir, uploadedFiles[0].FileName)); os.IsNotExist(err) {
 		t.Errorf("excpected file to exists: %s", err.Error())
 	}
 
-	// clean up
-	_ = os.Remove(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].OriginalFileName))
+	if uploadedFiles[0].OriginalFileName != "img.png" || uploadedFiles[0].ContentType != "image/png" {
+		t.Errorf("wrong metadata for uploaded file: %+v", uploadedFiles[0])
+	}
 
 	wg.Wait()
 }
@@ -240,47 +411,99 @@ func simulatePNGUpload(fileToUpload string, writer *multipart.Writer, t *testing
 }
 
 func Test_app_UploadProfilePic(t *testing.T) {
-	uploadPath = "./testdata/uploads"
+	oldUploadPath := uploadPath
+	defer func() { uploadPath = oldUploadPath }()
+
+	uploadPath = t.TempDir()
 	filePath := "./testdata/img.png"
 
-	// specify a field name for the form
-	fieldName := "file"
+	upload := func(userID int) *httptest.ResponseRecorder {
+		// specify a field name for the form
+		fieldName := "file"
 
-	// create a bytes.Buffer to add as request body
-	body := new(bytes.Buffer)
+		// create a bytes.Buffer to add as request body
+		body := new(bytes.Buffer)
 
-	// create a new writer
-	mw := multipart.NewWriter(body)
+		// create a new writer
+		mw := multipart.NewWriter(body)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		t.Fatal(err)
+		file, err := os.Open(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		w, err := mw.CreateFormFile(fieldName, filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.Copy(w, file); err != nil {
+			t.Fatal(err)
+		}
+
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/upload/", body)
+		req = addContextAndSessionToRequest(req, app)
+		app.Session.Put(req.Context(), "user", data.User{ID: userID})
+		req.Header.Add("Content-Type", mw.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(app.UploadProfilePic)
+		handler.ServeHTTP(rr, req)
+
+		if msg := app.Session.PopString(req.Context(), "error"); msg != "" {
+			t.Errorf("unexpected error: %s", msg)
+		}
+
+		return rr
 	}
 
-	w, err := mw.CreateFormFile(fieldName, filePath)
-	if err != nil {
-		t.Fatal(err)
+	// only the picture and its variants are served, never the upload
+	served := func() []string {
+		entries, _ := os.ReadDir(uploadPath)
+
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+
+		return names
 	}
 
-	if _, err := io.Copy(w, file); err != nil {
-		t.Fatal(err)
+	if rr := upload(2); rr.Code != http.StatusSeeOther {
+		t.Errorf("wrong status code")
 	}
 
-	mw.Close()
+	first := served()
+	if len(first) != 1+len(avatarSizes) {
+		t.Fatalf("expected the picture and %d variants; got %v", len(avatarSizes), first)
+	}
 
-	req := httptest.NewRequest(http.MethodPost, "/upload/", body)
-	req = addContextAndSessionToRequest(req, app)
-	app.Session.Put(req.Context(), "user", data.User{ID: 1})
-	req.Header.Add("Content-Type", mw.FormDataContentType())
+	// a new picture replaces the files of the old one
+	if rr := upload(2); rr.Code != http.StatusSeeOther {
+		t.Errorf("wrong status code")
+	}
 
-	rr := httptest.NewRecorder()
+	second := served()
+	if len(second) != 1+len(avatarSizes) {
+		t.Errorf("expected the picture and %d variants; got %v", len(avatarSizes), second)
+	}
 
-	handler := http.HandlerFunc(app.UploadProfilePic)
-	handler.ServeHTTP(rr, req)
+	for _, name := range first {
+		if _, err := os.Stat(filepath.Join(uploadPath, name)); !os.IsNotExist(err) {
+			t.Errorf("file %s of the old picture was kept", name)
+		}
+	}
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("wrong status code")
+	// a picture that can't be stored leaves no files behind
+	if rr := upload(100); rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 for an unknown user; got %d", rr.Code)
 	}
 
-	_ = os.Remove("./testdata/uploads/img.png")
+	if after := served(); len(after) != len(second) {
+		t.Errorf("expected the files of the failed upload to be removed; got %v", after)
+	}
 }
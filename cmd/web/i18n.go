@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+)
+
+// localeCookie remembers the language chosen by visitors that are not logged in.
+const localeCookie = "lang"
+
+// printer returns the printer of the language of the request, which
+// translates messages shown to the user.
+func printer(r *http.Request) *i18n.Printer {
+	return i18n.FromContext(r.Context())
+}
+
+// userPrinter returns the printer of the language user chose, for emails, which
+// may be sent from the request of someone else. Without a choice it is English.
+func (app *application) userPrinter(user *data.User) *i18n.Printer {
+	return app.Catalog.Printer(app.Catalog.Match(user.Locale))
+}
+
+// localeOption is a language that can be chosen, with its name in that language.
+type localeOption struct {
+	Tag  string
+	Name string
+}
+
+// languages returns the languages of the catalog, for the language switcher.
+func (app *application) languages() []localeOption {
+	var options []localeOption
+	for _, tag := range app.Catalog.Tags() {
+		options = append(options, localeOption{Tag: tag.String(), Name: i18n.Name(tag)})
+	}
+
+	return options
+}
+
+// locale picks the language of the request: the one chosen by the user, else
+// the one of the cookie, else the best match for Accept-Language.
+func (app *application) locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var preferences []string
+
+		if user, ok := app.Session.Get(r.Context(), "user").(data.User); ok && user.Locale != "" {
+			preferences = append(preferences, user.Locale)
+		}
+
+		if c, err := r.Cookie(localeCookie); err == nil {
+			preferences = append(preferences, c.Value)
+		}
+
+		preferences = append(preferences, r.Header.Get("Accept-Language"))
+
+		p := app.Catalog.Printer(app.Catalog.Match(preferences...))
+
+		w.Header().Set("Content-Language", p.Tag().String())
+		w.Header().Add("Vary", "Accept-Language")
+
+		next.ServeHTTP(w, r.WithContext(i18n.NewContext(r.Context(), p)))
+	})
+}
+
+// PostLocale changes the language. It is kept in a cookie, and for users that
+// are logged in also as their preference, so it follows them to other devices.
+func (app *application) PostLocale(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	locale := r.PostForm.Get("locale")
+	if !app.Catalog.Supported(locale) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     localeCookie,
+		Value:    locale,
+		Path:     "/",
+		Expires:  time.Now().AddDate(1, 0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if app.Session.Exists(r.Context(), "user") {
+		sessionUser := app.Session.Get(r.Context(), "user").(data.User)
+
+		user, err := app.DB.GetUser(sessionUser.ID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		user.Locale = locale
+		if err := app.DB.UpdateUser(*user); err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := app.refreshSessionUser(r, user.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// back to the page the language was changed on
+	target := "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && ref.Path != "" {
+		target = ref.RequestURI()
+	}
+
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/mailer"
+
+	"golang.org/x/text/language"
+)
+
+func Test_app_locale(t *testing.T) {
+	var tests = []struct {
+		name           string
+		acceptLanguage string
+		cookie         string
+		userLocale     string
+		expectedLang   string
+	}{
+		{"default", "", "", "", "en"},
+		{"accept-language", "fr-CH, de;q=0.8", "", "", "de"},
+		{"unsupported", "fr-CH, fr;q=0.9", "", "", "en"},
+		{"cookie-wins", "de", "en", "", "en"},
+		{"user-wins", "en", "en", "de", "de"},
+	}
+
+	for _, e := range tests {
+		token := ""
+		if e.userLocale != "" {
+			token = loginSession(t, data.User{ID: 1, Locale: e.userLocale}, "Firefox")
+		}
+
+		req := sessionRequest("GET", "/", token)
+		if e.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", e.acceptLanguage)
+		}
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: localeCookie, Value: e.cookie})
+		}
+
+		var got string
+		handler := app.locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = i18n.FromContext(r.Context()).Tag().String()
+		}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if got != e.expectedLang {
+			t.Errorf("%s: expected language %s; got %s", e.name, e.expectedLang, got)
+		}
+
+		if rr.Header().Get("Content-Language") != e.expectedLang {
+			t.Errorf("%s: wrong Content-Language: %q", e.name, rr.Header().Get("Content-Language"))
+		}
+	}
+}
+
+func Test_app_locale_translatesPages(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req.Header.Set("Accept-Language", "de-DE")
+
+	rr := httptest.NewRecorder()
+	app.locale(http.HandlerFunc(app.Home)).ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "Startseite") || !strings.Contains(body, `lang="de"`) {
+		t.Error("expected the home page in German")
+	}
+}
+
+func Test_app_PostLocale(t *testing.T) {
+	var tests = []struct {
+		name             string
+		locale           string
+		referer          string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"valid", "de", "", http.StatusSeeOther, "/"},
+		{"back-to-page", "de", "http://example.com/user/profile?tab=1", http.StatusSeeOther, "/user/profile?tab=1"},
+		{"other-host", "de", "http://evil.example.org/phish", http.StatusSeeOther, "/"},
+		{"unsupported", "fr", "", http.StatusBadRequest, ""},
+		{"invalid", "<script>", "", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "http://example.com/locale", strings.NewReader(url.Values{"locale": {e.locale}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.referer != "" {
+			req.Header.Set("Referer", e.referer)
+		}
+		req = addContextAndSessionToRequest(req, app)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.PostLocale).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatus, rr.Code)
+			continue
+		}
+
+		if e.expectedStatus != http.StatusSeeOther {
+			continue
+		}
+
+		if rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %s; got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != localeCookie || cookies[0].Value != e.locale {
+			t.Errorf("%s: expected the lang cookie; got %v", e.name, cookies)
+		}
+	}
+}
+
+func TestForm_translated(t *testing.T) {
+	form := NewForm(url.Values{}, app.Catalog.Printer(language.German))
+	form.Required("name")
+
+	if got := form.Errors.Get("name"); got != "Dieses Feld ist erforderlich" {
+		t.Errorf("expected a German error; got %q", got)
+	}
+}
+
+func Test_app_emails_translated(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	var tests = []struct {
+		name            string
+		send            func(*data.User) error
+		locale          string
+		expectedSubject string
+		expectedText    string
+	}{
+		{"verification", app.sendEmailVerification, "de", "Bestätige deine E-Mail-Adresse", "Hallo John,"},
+		{"verification-no-locale", app.sendEmailVerification, "", "Confirm your email address", "Hi John,"},
+		{"reset", app.sendPasswordReset, "de", "Setze dein Passwort zurück", "bleibt unverändert"},
+		{"reset-no-locale", app.sendPasswordReset, "", "Reset your password", "your password stays the same"},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+		// the language is the one the user chose, not the one of the request
+		user := &data.User{ID: 3, FirstName: "John", Email: "john@example.com", Locale: e.locale}
+		if err := e.send(user); err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+
+		mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(mails) != 1 {
+			t.Fatalf("%s: expected one mail; got %d", e.name, len(mails))
+		}
+		content, _ := os.ReadFile(mails[0])
+
+		if !strings.Contains(string(content), "Subject: "+e.expectedSubject) {
+			t.Errorf("%s: expected subject %q in %s", e.name, e.expectedSubject, content)
+		}
+
+		if !strings.Contains(string(content), e.expectedText) {
+			t.Errorf("%s: expected %q in %s", e.name, e.expectedText, content)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"webapp/pkg/data"
+	"webapp/pkg/imaging"
+)
+
+// maxImageSize is the largest width or height profile pictures are kept with.
+const maxImageSize = 1024
+
+// avatarSizes are the square thumbnails made of every profile picture. Templates
+// pick one by name, with ProfilePic.Variant.
+var avatarSizes = []struct {
+	name string
+	size int
+}{
+	{"small", 64},
+	{"medium", 128},
+	{"large", 256},
+}
+
+// processProfilePic turns an upload in uploadDir into the picture that is
+// served from imageDir: upright, scaled down and encoded again, without the
+// metadata of the upload. It also makes the avatarSizes thumbnails. The upload
+// itself is removed.
+func processProfilePic(uploadDir, imageDir string, upload *UploadedFile) (*data.UserImage, error) {
+	uploadPath := filepath.Join(uploadDir, upload.FileName)
+	defer func() {
+		if err := os.Remove(uploadPath); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	f, err := os.Open(uploadPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, format, err := imaging.Normalize(f, maxImageSize)
+	if err == imaging.ErrTooLarge {
+		return nil, uploadErrorf("%s has too many pixels", upload.OriginalFileName)
+	} else if err != nil {
+		return nil, uploadErrorf("%s could not be read as an image", upload.OriginalFileName)
+	}
+
+	base, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	ext := imaging.Extension(format)
+
+	pic := &data.UserImage{
+		FileName:         base + ext,
+		OriginalFileName: upload.OriginalFileName,
+	}
+
+	written := []string{pic.FileName}
+	if err := saveImage(filepath.Join(imageDir, pic.FileName), img, format); err != nil {
+		return nil, err
+	}
+
+	for _, s := range avatarSizes {
+		variant := data.ImageVariant{
+			Name:     s.name,
+			FileName: fmt.Sprintf("%s-%d%s", base, s.size, ext),
+			Width:    s.size,
+			Height:   s.size,
+		}
+
+		if err := saveImage(filepath.Join(imageDir, variant.FileName), imaging.Thumbnail(img, s.size), format); err != nil {
+			for _, name := range written {
+				_ = os.Remove(filepath.Join(imageDir, name))
+			}
+			return nil, err
+		}
+
+		written = append(written, variant.FileName)
+		pic.Variants = append(pic.Variants, variant)
+	}
+
+	return pic, nil
+}
+
+// saveImage encodes img as format, and writes it to name.
+func saveImage(name string, img image.Image, format string) error {
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format); err != nil {
+		return err
+	}
+
+	_, err := writeFileAtomic(name, &buf)
+
+	return err
+}
+
+// removeProfilePic removes the files of pic, and of its variants, from imageDir.
+func removeProfilePic(imageDir string, pic *data.UserImage) {
+	names := []string{pic.FileName}
+	for _, v := range pic.Variants {
+		names = append(names, v.FileName)
+	}
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(imageDir, name)); err != nil && !os.IsNotExist(err) {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// storeTestUpload copies content into uploadDir, as uploadFiles would.
+func storeTestUpload(t *testing.T, uploadDir string, content []byte) *UploadedFile {
+	upload := &UploadedFile{FileName: "upload.png", OriginalFileName: "me.png"}
+	if err := os.WriteFile(filepath.Join(uploadDir, upload.FileName), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return upload
+}
+
+func Test_processProfilePic(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadDir, imageDir := t.TempDir(), t.TempDir()
+	upload := storeTestUpload(t, uploadDir, png)
+
+	pic, err := processProfilePic(uploadDir, imageDir, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pic.OriginalFileName != "me.png" || filepath.Ext(pic.FileName) != ".png" {
+		t.Errorf("wrong image: %+v", pic)
+	}
+
+	if len(pic.Variants) != len(avatarSizes) {
+		t.Fatalf("expected %d variants; got %d", len(avatarSizes), len(pic.Variants))
+	}
+
+	for _, v := range pic.Variants {
+		f, err := os.Open(filepath.Join(imageDir, v.FileName))
+		if err != nil {
+			t.Errorf("variant %s was not stored: %s", v.Name, err)
+			continue
+		}
+
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || config.Width != v.Width || config.Height != v.Height {
+			t.Errorf("variant %s: expected %dx%d; got %dx%d, %v", v.Name, v.Width, v.Height, config.Width, config.Height, err)
+		}
+	}
+
+	if pic.Variant("small") == pic.FileName {
+		t.Error("expected a small variant")
+	}
+
+	// the upload itself is not kept
+	if _, err := os.Stat(filepath.Join(uploadDir, upload.FileName)); !os.IsNotExist(err) {
+		t.Error("the upload was not removed")
+	}
+}
+
+func Test_processProfilePic_broken(t *testing.T) {
+	uploadDir, imageDir := t.TempDir(), t.TempDir()
+
+	// looks like a png, but isn't one
+	upload := storeTestUpload(t, uploadDir, []byte("\x89PNG\r\n\x1a\nbroken"))
+
+	_, err := processProfilePic(uploadDir, imageDir, upload)
+	if _, ok := err.(*uploadError); !ok {
+		t.Errorf("expected an upload error; got %v", err)
+	}
+
+	for _, dir := range []string{uploadDir, imageDir} {
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("expected no files to be kept; got %d", len(entries))
+		}
+	}
+}
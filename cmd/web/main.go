@@ -3,31 +3,114 @@ package main
 import (
 	"encoding/gob"
 	"flag"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	"webapp/locales"
 	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/lockout"
+	"webapp/pkg/mailer"
+	"webapp/pkg/netutil"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository"
 	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/sessionstore"
+	"webapp/templates"
 
 	"github.com/alexedwards/scs/v2"
 )
 
 type application struct {
-	DSN string
+	DSN     string
+	BaseURL string
 
-	DB      repository.DatabaseRepo
-	Session *scs.SessionManager
+	// VerificationKey signs the links of verification emails
+	VerificationKey []byte
+
+	DB           repository.DatabaseRepo
+	Session      *scs.SessionManager
+	SessionStore sessionstore.Store
+	Lockout      *lockout.Guard
+	// TrustedProxies may set X-Forwarded-For, see clientIP
+	TrustedProxies netutil.TrustedProxies
+	RateLimit      ratelimit.Store
+	Mailer         mailer.Mailer
+	Templates      *templateCache
+	Catalog        *i18n.Catalog
 }
 
 func main() {
 	gob.Register(data.User{})
+	gob.Register(time.Time{})
 
 	// set up an app config
 	app := application{}
 
 	flag.StringVar(&app.DSN, "dsn", "host=localhost port=6432 user=postgres password=postgres dbname=users sslmode=disable timezone=UTC connect_timeout=5", "postgres connection")
+	lockoutStore := flag.String("lockout-store", "postgres", "where failed logins are counted: memory|postgres")
+	rateLimitStore := flag.String("rate-limit-store", "postgres", "where rate limit buckets are kept: memory|postgres")
+	dev := flag.Bool("dev", false, "parse templates from -templates-dir, again whenever they change")
+	templatesDir := flag.String("templates-dir", "./templates", "directory templates are read from in dev mode")
+	trustedProxies := flag.String("trusted-proxies", "", "comma separated addresses or networks of proxies whose X-Forwarded-For is believed")
+	sessionStore := flag.String("session-store", "postgres", "where sessions are kept: memory|postgres")
+	flag.StringVar(&app.BaseURL, "base-url", "http://localhost:8080", "public url of the application, used in links sent by email")
+	verificationKey := flag.String("verification-key", os.Getenv("VERIFICATION_KEY"), "secret used to sign email verification links, defaults to $VERIFICATION_KEY")
+	mailerKind := flag.String("mailer", "file", "how emails are sent: file|smtp")
+	mailDir := flag.String("mail-dir", "", "directory the file mailer writes emails to, they are logged when empty")
+	mailFrom := flag.String("mail-from", "no-reply@example.com", "sender address of emails")
+	smtpHost := flag.String("smtp-host", "localhost", "smtp server host")
+	smtpPort := flag.Int("smtp-port", 587, "smtp server port")
+	smtpUser := flag.String("smtp-user", "", "smtp username, leave empty to send without authentication")
+	smtpPassword := flag.String("smtp-password", "", "smtp password")
 	flag.Parse()
 
+	// anyone who knows the key can verify any email address, so there is no default
+	if *verificationKey == "" {
+		log.Fatal("a verification key is required, set -verification-key or VERIFICATION_KEY")
+	}
+	app.VerificationKey = []byte(*verificationKey)
+
+	// templates are embedded in the binary, unless they are being worked on
+	var templateFS fs.FS = templates.FS
+	if *dev {
+		templateFS = os.DirFS(*templatesDir)
+	}
+
+	catalog, err := i18n.Load(locales.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Catalog = catalog
+
+	cache, err := newTemplateCache(templateFS, catalog, *dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Templates = cache
+
+	app.TrustedProxies, err = netutil.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *mailerKind {
+	case "file":
+		app.Mailer = &mailer.FileMailer{Dir: *mailDir, From: *mailFrom}
+	case "smtp":
+		app.Mailer = &mailer.SMTPMailer{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUser,
+			Password: *smtpPassword,
+			From:     *mailFrom,
+		}
+	default:
+		log.Fatalf("unknown mailer %q", *mailerKind)
+	}
+
 	conn, err := app.connectToDB()
 	if err != nil {
 		log.Fatal(err)
@@ -38,8 +121,44 @@ func main() {
 		DB: conn,
 	}
 
+	// count failed logins, to lock out brute force attacks
+	switch *lockoutStore {
+	case "memory":
+		app.Lockout = lockout.New(lockout.NewMemoryStore())
+	case "postgres":
+		app.Lockout = lockout.New(&lockout.PostgresStore{DB: conn})
+	default:
+		log.Fatalf("unknown lockout store %q", *lockoutStore)
+	}
+	stopCleanup := app.Lockout.StartCleanup(time.Hour)
+	defer stopCleanup()
+
+	// rate limit buckets, shared by every instance when kept in postgres
+	switch *rateLimitStore {
+	case "memory":
+		app.RateLimit = ratelimit.NewMemoryStore()
+	case "postgres":
+		app.RateLimit = &ratelimit.PostgresStore{DB: conn}
+	default:
+		log.Fatalf("unknown rate limit store %q", *rateLimitStore)
+	}
+	stopRateLimitCleanup := ratelimit.StartCleanup(app.RateLimit, time.Hour, time.Hour)
+	defer stopRateLimitCleanup()
+
+	// sessions survive restarts and are shared by every instance when kept in postgres
+	switch *sessionStore {
+	case "memory":
+		app.SessionStore = sessionstore.NewMemoryStore()
+	case "postgres":
+		app.SessionStore = &sessionstore.PostgresStore{DB: conn}
+	default:
+		log.Fatalf("unknown session store %q", *sessionStore)
+	}
+	stopSessionCleanup := sessionstore.StartCleanup(app.SessionStore, time.Hour)
+	defer stopSessionCleanup()
+
 	// get a session manager
-	app.Session = getSession()
+	app.Session = getSession(app.SessionStore)
 
 	// printout message
 	log.Println("Starting server on port 8080...")
@@ -1,74 +1,99 @@
 package main
 
 import (
-	"context"
+	"database/sql"
 	"fmt"
-	"net"
+	"log"
 	"net/http"
+	"webapp/pkg/data"
+	"webapp/pkg/ratelimit"
 )
 
-type contextKey string
+// clientIP returns the ip address of the client, for lockouts, rate limits and
+// the session index. X-Forwarded-For is only believed from TrustedProxies.
+func (app *application) clientIP(r *http.Request) string {
+	return app.TrustedProxies.ClientIP(r)
+}
 
-const contextUserKey contextKey = "user_ip"
+// limitBody caps the body of every request at maxUploadSize, the largest form
+// the app accepts. It must come before anything that reads the form, like csrf.
+func (app *application) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		}
 
-func (app *application) ipFromContext(ctx context.Context) string {
-	return ctx.Value(contextUserKey).(string)
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (app *application) addIpToContext(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		var ctx = context.Background()
-		// get the ip
-		ip, err := getIP(request)
-
-		if err != nil {
-			ip, _, _ := net.SplitHostPort(request.RemoteAddr)
+func (app *application) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.Session.Exists(r.Context(), "user") {
+			app.Session.Put(r.Context(), "error", printer(r).Sprintf("Log in first!"))
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
 
-			if len(ip) == 0 {
-				ip = "unknown"
+		if user, ok := app.Session.Get(r.Context(), "user").(data.User); ok && !user.EmailVerified() {
+			// the address may have been confirmed since the user logged in
+			updatedUser, err := app.DB.GetUser(user.ID)
+			if err != nil || !updatedUser.EmailVerified() {
+				http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+				return
 			}
-
-			ctx = context.WithValue(request.Context(), contextUserKey, ip)
-		} else {
-			ctx = context.WithValue(request.Context(), contextUserKey, ip)
+			app.Session.Put(r.Context(), "user", *updatedUser)
 		}
 
-		next.ServeHTTP(writer, request.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
-func getIP(r *http.Request) (string, error) {
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+// adminOnly lets only admins through. It must come after auth. The admin flag
+// is read from the database, so taking it away takes effect right away.
+func (app *application) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := app.Session.Get(r.Context(), "user").(data.User)
 
-	if err != nil {
-		return "unknown", err
-	}
+		current, err := app.DB.GetUser(user.ID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
 
-	userIP := net.ParseIP(ip)
-	if userIP == nil {
-		return "", fmt.Errorf("userip: %q is not IP:port", r.RemoteAddr)
-	}
+		if current == nil || current.IsAdmin != 1 {
+			app.Session.Put(r.Context(), "error", printer(r).Sprintf("You don't have access to that page."))
+			http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+			return
+		}
 
-	forward := r.Header.Get("X-Forwarded-For")
-	if len(forward) > 0 {
-		ip = forward
-	}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	if len(ip) == 0 {
-		ip = "forward"
+// rateLimit limits a group of routes to rate requests per client, as returned by key.
+func (app *application) rateLimit(name string, rate ratelimit.Rate, key ratelimit.KeyFunc) func(http.Handler) http.Handler {
+	limiter := &ratelimit.Limiter{
+		Name:  name,
+		Store: app.RateLimit,
+		Rate:  rate,
+		Key:   key,
 	}
 
-	return ip, nil
+	return limiter.Handler
 }
 
-func (app *application) auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !app.Session.Exists(r.Context(), "user") {
-			app.Session.Put(r.Context(), "error", "Log in first!")
-			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-			return
-		}
+// limitBySubject limits requests of logged-in users by user, and others by ip.
+func (app *application) limitBySubject(r *http.Request) string {
+	if user, ok := app.Session.Get(r.Context(), "user").(data.User); ok {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	return "ip:" + app.clientIP(r)
+}
+
+// limitByIP limits requests by the ip address of the client.
+func (app *application) limitByIP(r *http.Request) string {
+	return "ip:" + app.clientIP(r)
 }
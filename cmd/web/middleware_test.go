@@ -1,113 +1,83 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
+	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/ratelimit"
 )
 
-func Test_application_addIPToContext(t *testing.T) {
-	tests := []struct {
-		headerName  string
-		headerValue string
-		addr        string
-		emptyAddr   bool
-	}{
-		{"", "", "", false},
-		{"", "", "", true},
-		{"X-Forwarded-For", "192.2.2.1", "", false},
-		{"", "", "hello:world", false},
-	}
-
-	// create dummy handler to check context
+func Test_app_auth(t *testing.T) {
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// value exists in context
-		val := r.Context().Value(contextUserKey)
-
-		if val == nil {
-			t.Error(contextUserKey, "not present")
-		}
 
-		// make sure it is string
-		ip, ok := val.(string)
-		if !ok {
-			t.Error("not string")
-		}
-		t.Log(ip)
 	})
 
+	var tests = []struct {
+		name         string
+		user         *data.User
+		expectedCode int
+		expectedLoc  string
+	}{
+		{"logged in", &data.User{ID: 1, EmailVerifiedAt: time.Now()}, http.StatusOK, ""},
+		{"verified since login", &data.User{ID: 1}, http.StatusOK, ""},
+		{"unverified email", &data.User{ID: 3}, http.StatusSeeOther, "/verify-email"},
+		{"not logged in", nil, http.StatusTemporaryRedirect, "/"},
+	}
+
 	for _, e := range tests {
-		// create handler
-		handlerToTest := app.addIpToContext(nextHandler)
+		handlerToTest := app.auth(nextHandler)
 
 		req := httptest.NewRequest("GET", "http://testing", nil)
+		req = addContextAndSessionToRequest(req, app)
 
-		if e.emptyAddr {
-			req.RemoteAddr = ""
+		if e.user != nil {
+			app.Session.Put(req.Context(), "user", *e.user)
 		}
+		rr := httptest.NewRecorder()
+		handlerToTest.ServeHTTP(rr, req)
 
-		if len(e.headerName) > 0 {
-			req.Header.Add(e.headerName, e.headerValue)
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: excpected status code %d; got %d", e.name, e.expectedCode, rr.Code)
 		}
 
-		if len(e.addr) > 0 {
-			req.RemoteAddr = e.addr
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected redirect to %q; got %q", e.name, e.expectedLoc, loc)
 		}
-
-		handlerToTest.ServeHTTP(httptest.NewRecorder(), req)
 	}
 }
 
-func Test_application_ipFromContext(t *testing.T) {
-	// get a context
-	ctx := context.Background()
-
-	// put something in context using contex
-	ctx = context.WithValue(ctx, contextUserKey, "test1")
-
-	//call the function
-	ip := app.ipFromContext(ctx)
-
-	// perform test
-	if !strings.EqualFold("test1", ip) {
-		t.Error("wrong value returned from context")
-	}
-}
-
-func Test_app_auth(t *testing.T) {
-	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-	})
-
+func Test_app_rateLimit_spoofedIP(t *testing.T) {
 	var tests = []struct {
-		name   string
-		isAuth bool
+		name string
+		key  func(*http.Request) string
 	}{
-		{"logged in", true},
-		{"not logged in", false},
+		{"by-ip", app.limitByIP},
+		{"by-subject", app.limitBySubject},
 	}
 
-	for _, e := range tests {
-		handlerToTest := app.auth(nextHandler)
-
-		req := httptest.NewRequest("GET", "http://testing", nil)
-		req = addContextAndSessionToRequest(req, app)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-		if e.isAuth {
-			app.Session.Put(req.Context(), "user", data.User{ID: 1})
-		}
-		rr := httptest.NewRecorder()
-		handlerToTest.ServeHTTP(rr, req)
-
-		if e.isAuth && rr.Code != http.StatusOK {
-			t.Errorf("%s: excpected status code 200; got %d", e.name, rr.Code)
+	for _, e := range tests {
+		handler := app.rateLimit("spoofed-"+e.name, ratelimit.PerMinute(2), e.key)(next)
+
+		var codes []int
+		for i := 1; i <= 3; i++ {
+			req, _ := http.NewRequest("POST", "/login", nil)
+			req = addContextAndSessionToRequest(req, app)
+			req.RemoteAddr = "192.0.2.1:1234"
+			// a new forwarded address for every request doesn't get a new bucket
+			req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+			codes = append(codes, rr.Code)
 		}
 
-		if !e.isAuth && rr.Code != http.StatusTemporaryRedirect {
-			t.Errorf("%s: excpected status code 307; got %d", e.name, rr.Code)
+		if codes[2] != http.StatusTooManyRequests {
+			t.Errorf("%s: expected the third request to be limited; got %v", e.name, codes)
 		}
 	}
 }
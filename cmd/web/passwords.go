@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+)
+
+// resetTokenTTL is how long a password reset link can be used.
+const resetTokenTTL = time.Hour
+
+func (app *application) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	_ = app.render(w, r, "forgot-password.page.gohtml", &TemplateData{Form: NewForm(nil)})
+}
+
+func (app *application) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := NewForm(r.PostForm, printer(r))
+	form.Required("email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = app.render(w, r, "forgot-password.page.gohtml", &TemplateData{Form: form})
+		return
+	}
+
+	// the answer is the same whether the account exists or not, so the form
+	// can't be used to find out who has an account
+	user, err := app.DB.GetUserByEmail(strings.TrimSpace(form.Data.Get("email")))
+	if err == nil {
+		if err := app.sendPasswordReset(user); err != nil {
+			log.Println(err)
+		}
+	} else if err != sql.ErrNoRows {
+		log.Println(err)
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("If an account exists for this email, we have sent you a link to reset your password."))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// sendPasswordReset stores a new reset token for user, and emails them the
+// link, in the language they chose.
+func (app *application) sendPasswordReset(user *data.User) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = app.DB.InsertPasswordReset(data.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(resetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", app.BaseURL, url.QueryEscape(token))
+	p := app.userPrinter(user)
+
+	return app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: p.Sprintf("Reset your password"),
+		Body: fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s\n",
+			p.Sprintf("Hi %s,", user.FirstName),
+			p.Sprintf("Someone asked to reset the password of your account. Use this link within the next hour to choose a new password:"),
+			link,
+			p.Sprintf("If it wasn't you, you can ignore this email, your password stays the same.")),
+	})
+}
+
+// validPasswordReset returns the unused and unexpired reset of token.
+func (app *application) validPasswordReset(token string) (*data.PasswordReset, error) {
+	if token == "" {
+		return nil, sql.ErrNoRows
+	}
+
+	reset, err := app.DB.GetPasswordReset(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if !reset.UsedAt.IsZero() || !reset.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+
+	return reset, nil
+}
+
+func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	if _, err := app.validPasswordReset(token); err != nil {
+		app.invalidPasswordReset(w, r, err)
+		return
+	}
+
+	form := NewForm(url.Values{"token": {token}})
+	_ = app.render(w, r, "reset-password.page.gohtml", &TemplateData{Form: form})
+}
+
+func (app *application) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := NewForm(r.PostForm, printer(r))
+
+	reset, err := app.validPasswordReset(form.Data.Get("token"))
+	if err != nil {
+		app.invalidPasswordReset(w, r, err)
+		return
+	}
+
+	form.Required("password", "confirm_password")
+	form.StrongPassword("password", minPasswordLength)
+	form.EqualFields("password", "confirm_password")
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = app.render(w, r, "reset-password.page.gohtml", &TemplateData{Form: form})
+		return
+	}
+
+	// marking the reset as used is what makes the token single use, even when
+	// the form is sent twice at the same time
+	used, err := app.DB.UsePasswordReset(reset.ID)
+	if err != nil || !used {
+		app.invalidPasswordReset(w, r, err)
+		return
+	}
+
+	user, err := app.DB.GetUser(reset.UserID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.ResetPassword(user.ID, form.Data.Get("password")); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// whoever knew the old password is logged out, on the web and the api
+	if err := app.SessionStore.RevokeAll(user.ID); err != nil {
+		log.Println(err)
+	}
+
+	if err := app.DB.RevokeUserRefreshTokens(user.ID); err != nil {
+		log.Println(err)
+	}
+
+	// whoever locked the account out did not know the new password
+	if err := app.Lockout.Unlock(user.Email); err != nil {
+		log.Println(err)
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Your password has been reset, you can log in now."))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// invalidPasswordReset sends the user back to ask for a new link.
+func (app *application) invalidPasswordReset(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+
+	app.Session.Put(r.Context(), "error", printer(r).Sprintf("This password reset link is invalid or has expired, please ask for a new one."))
+	http.Redirect(w, r, "/forgot-password", http.StatusSeeOther)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+)
+
+var resetLink = regexp.MustCompile(`/reset-password\?token=([A-Za-z0-9_-]+)`)
+
+func postForm(handler http.HandlerFunc, target string, postData url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", target, strings.NewReader(postData.Encode()))
+	req = addContextAndSessionToRequest(req, app)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// issueRefreshToken stores a refresh token of the api for userID, as if they
+// had logged in there, and returns its hash.
+func issueRefreshToken(t *testing.T, userID int) string {
+	t.Helper()
+
+	token, _ := randomToken()
+	hash := hashToken(token)
+
+	_, err := app.DB.InsertRefreshToken(data.RefreshToken{UserID: userID, TokenHash: hash, FamilyID: hash, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+// refreshTokenRevoked reports whether the refresh token with hash was revoked.
+func refreshTokenRevoked(t *testing.T, hash string) bool {
+	t.Helper()
+
+	token, err := app.DB.GetRefreshToken(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return !token.RevokedAt.IsZero()
+}
+
+func Test_app_forgotPassword(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	var tests = []struct {
+		name               string
+		email              string
+		expectedStatusCode int
+		expectedMails      int
+	}{
+		{"known-email", "jane@example.com", http.StatusSeeOther, 1},
+		{"unknown-email", "nobody@example.com", http.StatusSeeOther, 0},
+		{"invalid-email", "jane", http.StatusUnprocessableEntity, 0},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+		rr := postForm(app.PostForgotPassword, "/forgot-password", url.Values{"email": {e.email}})
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(mails) != e.expectedMails {
+			t.Errorf("%s: expected %d mails; got %d", e.name, e.expectedMails, len(mails))
+		}
+	}
+}
+
+func Test_app_resetPassword(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	dir := t.TempDir()
+	app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	user, _ := app.DB.GetUserByEmail("john@example.com")
+	if err := app.sendPasswordReset(user); err != nil {
+		t.Fatal(err)
+	}
+
+	mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(mails) != 1 {
+		t.Fatalf("expected one mail; got %d", len(mails))
+	}
+	content, _ := os.ReadFile(mails[0])
+
+	match := resetLink.FindStringSubmatch(string(content))
+	if match == nil {
+		t.Fatalf("no reset link in mail: %s", content)
+	}
+	token := match[1]
+
+	// the stored token is hashed
+	if _, err := app.DB.GetPasswordReset(token); err == nil {
+		t.Error("reset token is stored in plain text")
+	}
+
+	// the link shows the form
+	req, _ := http.NewRequest("GET", "/reset-password?token="+token, nil)
+	req = addContextAndSessionToRequest(req, app)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.ResetPassword).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), token) {
+		t.Errorf("expected the reset form; got status %d", rr.Code)
+	}
+
+	// a second link, from asking twice, stops working with the reset
+	otherToken, _ := randomToken()
+	_, _ = app.DB.InsertPasswordReset(data.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(otherToken),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	// whoever is logged in with the old password is logged out by the reset
+	session := loginSession(t, *user, "Firefox")
+	refreshToken := issueRefreshToken(t, user.ID)
+
+	var tests = []struct {
+		name               string
+		token              string
+		password           string
+		confirm            string
+		expectedStatusCode int
+		expectedLoc        string
+	}{
+		{"unknown-token", "nope", "newsecret1", "newsecret1", http.StatusSeeOther, "/forgot-password"},
+		{"weak-password", token, "short", "short", http.StatusUnprocessableEntity, ""},
+		{"wrong-confirmation", token, "newsecret1", "newsecret2", http.StatusUnprocessableEntity, ""},
+		{"valid", token, "newsecret1", "newsecret1", http.StatusSeeOther, "/"},
+		{"used-token", token, "newsecret1", "newsecret1", http.StatusSeeOther, "/forgot-password"},
+		{"other-token", otherToken, "newsecret2", "newsecret2", http.StatusSeeOther, "/forgot-password"},
+	}
+
+	reset := false
+	for _, e := range tests {
+		rr := postForm(app.PostResetPassword, "/reset-password", url.Values{
+			"token":            {e.token},
+			"password":         {e.password},
+			"confirm_password": {e.confirm},
+		})
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected redirect to %q; got %q", e.name, e.expectedLoc, loc)
+		}
+
+		if e.name == "valid" {
+			reset = true
+		}
+
+		_, found, _ := app.SessionStore.Find(session)
+		if found == reset {
+			t.Errorf("%s: session exists: %v, after the reset: %v", e.name, found, reset)
+		}
+		if refreshTokenRevoked(t, refreshToken) != reset {
+			t.Errorf("%s: refresh token revoked: %v, after the reset: %v", e.name, !reset, reset)
+		}
+	}
+}
+
+func Test_app_resetPassword_expired(t *testing.T) {
+	token, _ := randomToken()
+	_, _ = app.DB.InsertPasswordReset(data.PasswordReset{
+		UserID:    2,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+
+	req, _ := http.NewRequest("GET", "/reset-password?token="+token, nil)
+	req = addContextAndSessionToRequest(req, app)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.ResetPassword).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/forgot-password" {
+		t.Errorf("expected expired link to redirect to /forgot-password; got %q", loc)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"webapp/pkg/data"
+	"webapp/pkg/sessionstore"
+)
+
+// EditProfile shows the form to change the name and email address of the
+// logged-in user.
+func (app *application) EditProfile(w http.ResponseWriter, r *http.Request) {
+	user := app.Session.Get(r.Context(), "user").(data.User)
+
+	form := NewForm(url.Values{
+		"first_name": {user.FirstName},
+		"last_name":  {user.LastName},
+		"email":      {user.Email},
+	})
+
+	_ = app.render(w, r, "edit-profile.page.gohtml", &TemplateData{Form: form})
+}
+
+// PostEditProfile updates the name and email address of the logged-in user. A
+// new email address has to be confirmed before the user area can be used again.
+func (app *application) PostEditProfile(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// the session copy may be stale, e.g. the admin flag, so start from the database
+	sessionUser := app.Session.Get(r.Context(), "user").(data.User)
+	user, err := app.DB.GetUser(sessionUser.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	form := NewForm(r.PostForm, printer(r))
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+
+	email := strings.TrimSpace(form.Data.Get("email"))
+	emailChanged := email != user.Email
+
+	if form.Valid() && emailChanged {
+		_, err := app.DB.GetUserByEmail(email)
+		switch {
+		case err == nil:
+			form.Errors.Add("email", printer(r).Sprintf("This email address is already registered"))
+		case err != sql.ErrNoRows:
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = app.render(w, r, "edit-profile.page.gohtml", &TemplateData{Form: form})
+		return
+	}
+
+	user.FirstName = strings.TrimSpace(form.Data.Get("first_name"))
+	user.LastName = strings.TrimSpace(form.Data.Get("last_name"))
+	user.Email = email
+
+	if err := app.DB.UpdateUser(*user); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.refreshSessionUser(r, user.ID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if emailChanged {
+		if err := app.sendEmailVerification(user); err != nil {
+			log.Println(err)
+		}
+
+		app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Your profile has been updated. Please confirm your new email address."))
+		http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Your profile has been updated."))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// ChangePassword shows the form to change the password of the logged-in user.
+func (app *application) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	_ = app.render(w, r, "change-password.page.gohtml", &TemplateData{Form: NewForm(nil)})
+}
+
+// PostChangePassword changes the password of the logged-in user, after checking
+// the current one. Every other session of the user is logged out.
+func (app *application) PostChangePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	sessionUser := app.Session.Get(r.Context(), "user").(data.User)
+	user, err := app.DB.GetUser(sessionUser.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	form := NewForm(r.PostForm, printer(r))
+	form.Required("current_password", "password", "confirm_password")
+	form.StrongPassword("password", minPasswordLength)
+	form.EqualFields("password", "confirm_password")
+
+	if form.Has("current_password") {
+		matches, err := user.PasswordMatches(form.Data.Get("current_password"))
+		if err != nil {
+			log.Println(err)
+		}
+		form.Check(matches, "current_password", "The current password is not correct")
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = app.render(w, r, "change-password.page.gohtml", &TemplateData{Form: form})
+		return
+	}
+
+	if err := app.DB.ResetPassword(user.ID, form.Data.Get("password")); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// a new token for this session, and no other sessions: a stolen session
+	// must not outlive the password it was opened with
+	_ = app.Session.RenewToken(r.Context())
+	app.renewCSRFToken(r.Context())
+	app.indexSession(r, *user)
+
+	if err := app.SessionStore.RevokeOthers(user.ID, sessionstore.ID(app.Session.Token(r.Context()))); err != nil {
+		log.Println(err)
+	}
+
+	// the api logs in with refresh tokens, none of them is kept
+	if err := app.DB.RevokeUserRefreshTokens(user.ID); err != nil {
+		log.Println(err)
+	}
+
+	if err := app.refreshSessionUser(r, user.ID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Your password has been changed. All other sessions have been logged out."))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// refreshSessionUser stores the current data of the user with id in the session.
+func (app *application) refreshSessionUser(r *http.Request, id int) error {
+	user, err := app.DB.GetUser(id)
+	if err != nil {
+		return err
+	}
+
+	app.Session.Put(r.Context(), "user", *user)
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+)
+
+func Test_app_editProfile(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	jane, _ := app.DB.GetUser(2)
+
+	var tests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+		expectedError      string
+		expectedMails      int
+	}{
+		{"valid", url.Values{"first_name": {"Jane"}, "last_name": {"Roe"}, "email": {"jane@example.com"}}, http.StatusSeeOther, "/user/profile", "", 0},
+		{"new-email", url.Values{"first_name": {"Jane"}, "last_name": {"Doe"}, "email": {"jane.doe@example.com"}}, http.StatusSeeOther, "/verify-email", "", 1},
+		{"missing-name", url.Values{"first_name": {" "}, "last_name": {"Doe"}, "email": {"jane@example.com"}}, http.StatusUnprocessableEntity, "", "This field is required", 0},
+		{"invalid-email", url.Values{"first_name": {"Jane"}, "last_name": {"Doe"}, "email": {"jane@"}}, http.StatusUnprocessableEntity, "", "Invalid email address", 0},
+		{"taken-email", url.Values{"first_name": {"Jane"}, "last_name": {"Doe"}, "email": {"admin@example.com"}}, http.StatusUnprocessableEntity, "", "already registered", 0},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+		token := loginSession(t, *jane, "Firefox")
+		req := formRequest("POST", "/user/profile/edit", token, "", e.postedData)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.PostEditProfile).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %q; got %q", e.name, e.expectedLocation, loc)
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("%s: expected %q in the page", e.name, e.expectedError)
+		}
+
+		mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(mails) != e.expectedMails {
+			t.Errorf("%s: expected %d mails; got %d", e.name, e.expectedMails, len(mails))
+		}
+	}
+}
+
+func Test_app_changePassword(t *testing.T) {
+	jane, _ := app.DB.GetUser(2)
+
+	var tests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedError      string
+	}{
+		{"wrong-current", url.Values{"current_password": {"wrong"}, "password": {"n3w-password"}, "confirm_password": {"n3w-password"}}, http.StatusUnprocessableEntity, "The current password is not correct"},
+		{"weak", url.Values{"current_password": {"secret"}, "password": {"short"}, "confirm_password": {"short"}}, http.StatusUnprocessableEntity, "Password must be at least"},
+		{"mismatch", url.Values{"current_password": {"secret"}, "password": {"n3w-password"}, "confirm_password": {"other"}}, http.StatusUnprocessableEntity, "The values do not match"},
+		{"missing-current", url.Values{"password": {"n3w-password"}, "confirm_password": {"n3w-password"}}, http.StatusUnprocessableEntity, "This field is required"},
+		{"valid", url.Values{"current_password": {"secret"}, "password": {"n3w-password"}, "confirm_password": {"n3w-password"}}, http.StatusSeeOther, ""},
+	}
+
+	for _, e := range tests {
+		token := loginSession(t, *jane, "Firefox")
+		other := loginSession(t, *jane, "Safari")
+		refreshToken := issueRefreshToken(t, jane.ID)
+
+		req := formRequest("POST", "/user/password", token, "", e.postedData)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.PostChangePassword).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("%s: expected %q in the page", e.name, e.expectedError)
+		}
+
+		_, found, _ := app.SessionStore.Find(other)
+		if changed := rr.Code == http.StatusSeeOther; found == changed {
+			t.Errorf("%s: other session exists: %v, after the password changed: %v", e.name, found, changed)
+		}
+
+		if changed := rr.Code == http.StatusSeeOther; refreshTokenRevoked(t, refreshToken) != changed {
+			t.Errorf("%s: refresh token revoked: %v, after the password changed: %v", e.name, !changed, changed)
+		}
+
+		if rr.Code == http.StatusSeeOther {
+			if _, ok := app.Session.Get(req.Context(), "user").(data.User); !ok {
+				t.Errorf("%s: expected the user in the session", e.name)
+			}
+
+			if app.Session.Token(req.Context()) == token {
+				t.Errorf("%s: expected a new session token", e.name)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"webapp/pkg/ratelimit"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,17 +13,51 @@ func (app *application) routes() http.Handler {
 
 	// register middleware
 	mux.Use(middleware.Recoverer)
-	mux.Use(app.addIpToContext)
 	mux.Use(app.Session.LoadAndSave)
+	mux.Use(app.trackSession)
+	mux.Use(app.locale)
+	mux.Use(app.limitBody)
+	mux.Use(app.csrf)
 
 	// register routes
 	mux.Get("/", app.Home)
-	mux.Post("/login", app.Login)
+	mux.Get("/register", app.Register)
+	mux.With(app.rateLimit("register", ratelimit.PerMinute(5), app.limitByIP)).Post("/register", app.PostRegister)
+	mux.Get("/forgot-password", app.ForgotPassword)
+	mux.With(app.rateLimit("forgot-password", ratelimit.PerMinute(5), app.limitByIP)).Post("/forgot-password", app.PostForgotPassword)
+	mux.Get("/reset-password", app.ResetPassword)
+	mux.With(app.rateLimit("reset-password", ratelimit.PerMinute(10), app.limitByIP)).Post("/reset-password", app.PostResetPassword)
+	mux.Get("/verify-email", app.VerifyEmail)
+	mux.Get("/verify-email/confirm", app.ConfirmEmail)
+	mux.With(app.rateLimit("verify-email", ratelimit.PerMinute(3), app.limitBySubject)).Post("/verify-email/resend", app.ResendVerification)
+	mux.With(app.rateLimit("login", ratelimit.PerMinute(10), app.limitByIP)).Post("/login", app.Login)
+
+	mux.Post("/logout", app.Logout)
+	mux.Post("/locale", app.PostLocale)
 
 	mux.Route("/user", func(mux chi.Router) {
 		mux.Use(app.auth)
 		mux.Get("/profile", app.Profile)
-		mux.Post("/upload-profile-pic", app.UploadProfilePic)
+		mux.Get("/profile/edit", app.EditProfile)
+		mux.Post("/profile/edit", app.PostEditProfile)
+		mux.Get("/password", app.ChangePassword)
+		mux.With(app.rateLimit("change-password", ratelimit.PerMinute(5), app.limitBySubject)).Post("/password", app.PostChangePassword)
+		mux.Get("/sessions", app.Sessions)
+		mux.Post("/sessions/revoke-others", app.RevokeOtherSessions)
+		mux.Post("/sessions/{sessionID}/revoke", app.RevokeSession)
+		mux.With(app.rateLimit("upload", ratelimit.PerMinute(5), app.limitBySubject)).Post("/upload-profile-pic", app.UploadProfilePic)
+	})
+
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.auth)
+		mux.Use(app.adminOnly)
+		mux.Get("/users", app.AdminUsers)
+		mux.Get("/users/{userID}", app.AdminEditUser)
+		mux.Post("/users/{userID}", app.AdminPostEditUser)
+		mux.Post("/users/{userID}/toggle-admin", app.AdminToggleAdmin)
+		mux.Post("/users/{userID}/reset-password", app.AdminResetPassword)
+		mux.Post("/users/{userID}/unlock", app.AdminUnlockUser)
+		mux.Post("/users/{userID}/delete", app.AdminDeleteUser)
 	})
 
 	// static assets
@@ -15,7 +15,32 @@ func Test_app_routes(t *testing.T) {
 	}{
 		{"/", "GET"},
 		{"/login", "POST"},
+		{"/register", "GET"},
+		{"/register", "POST"},
+		{"/forgot-password", "GET"},
+		{"/forgot-password", "POST"},
+		{"/reset-password", "GET"},
+		{"/reset-password", "POST"},
+		{"/verify-email", "GET"},
+		{"/verify-email/confirm", "GET"},
+		{"/verify-email/resend", "POST"},
 		{"/user/profile", "GET"},
+		{"/user/profile/edit", "GET"},
+		{"/user/profile/edit", "POST"},
+		{"/user/password", "GET"},
+		{"/user/password", "POST"},
+		{"/user/sessions", "GET"},
+		{"/user/sessions/revoke-others", "POST"},
+		{"/user/sessions/{sessionID}/revoke", "POST"},
+		{"/admin/users", "GET"},
+		{"/admin/users/{userID}", "GET"},
+		{"/admin/users/{userID}", "POST"},
+		{"/admin/users/{userID}/toggle-admin", "POST"},
+		{"/admin/users/{userID}/reset-password", "POST"},
+		{"/admin/users/{userID}/unlock", "POST"},
+		{"/admin/users/{userID}/delete", "POST"},
+		{"/logout", "POST"},
+		{"/locale", "POST"},
 		{"/static/*", "GET"},
 	}
 
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/sessionstore"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
 )
 
-func getSession() *scs.SessionManager {
+// touchInterval is how often the last-seen time of a session is updated.
+const touchInterval = time.Minute
+
+func getSession(store sessionstore.Store) *scs.SessionManager {
 	session := scs.New()
 
+	session.Store = store
 	session.Lifetime = 24 * time.Hour
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
@@ -17,3 +25,111 @@ func getSession() *scs.SessionManager {
 
 	return session
 }
+
+// trackSession keeps the session index up to date with the user, ip and user
+// agent of logged-in sessions.
+func (app *application) trackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := app.Session.Get(r.Context(), "user").(data.User)
+		token := app.Session.Token(r.Context())
+
+		if ok && token != "" && time.Since(app.Session.GetTime(r.Context(), "last_seen")) > touchInterval {
+			app.touchSession(r, user)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// touchSession records the ip and user agent of the session of user in the
+// session index.
+func (app *application) touchSession(r *http.Request, user data.User) {
+	err := app.SessionStore.Touch(app.Session.Token(r.Context()), sessionstore.Session{
+		UserID:    user.ID,
+		IP:        app.clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+
+	app.Session.Put(r.Context(), "last_seen", time.Now())
+}
+
+// indexSession adds a session that was just logged in, with a renewed token,
+// to the session index right away, so it can be revoked before it makes
+// another request. The index only takes sessions that are in the store, so
+// the session is saved first.
+func (app *application) indexSession(r *http.Request, user data.User) {
+	if _, _, err := app.Session.Commit(r.Context()); err != nil {
+		log.Println(err)
+		return
+	}
+
+	app.touchSession(r, user)
+}
+
+// Sessions lists the sessions of the logged-in user.
+func (app *application) Sessions(w http.ResponseWriter, r *http.Request) {
+	user := app.Session.Get(r.Context(), "user").(data.User)
+
+	sessions, err := app.SessionStore.List(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	td := map[string]any{
+		"sessions": sessions,
+		"current":  sessionstore.ID(app.Session.Token(r.Context())),
+	}
+
+	_ = app.render(w, r, "sessions.page.gohtml", &TemplateData{Data: td})
+}
+
+// RevokeSession logs out one session of the logged-in user.
+func (app *application) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := app.Session.Get(r.Context(), "user").(data.User)
+	id := chi.URLParam(r, "sessionID")
+
+	if id == sessionstore.ID(app.Session.Token(r.Context())) {
+		app.Logout(w, r)
+		return
+	}
+
+	if err := app.SessionStore.Revoke(user.ID, id); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("The session has been logged out."))
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+// RevokeOtherSessions logs out every session of the logged-in user, except this one.
+func (app *application) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user := app.Session.Get(r.Context(), "user").(data.User)
+
+	err := app.SessionStore.RevokeOthers(user.ID, sessionstore.ID(app.Session.Token(r.Context())))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("All other sessions have been logged out."))
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+// Logout destroys the session, which also removes it from the session index.
+func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := app.Session.Destroy(r.Context()); err != nil {
+		log.Println(err)
+	}
+
+	// a new session, only for the message
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("You have been logged out."))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
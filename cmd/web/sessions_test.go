@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/sessionstore"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// loginSession stores a session of user, seen from userAgent, and returns its token.
+func loginSession(t *testing.T, user data.User, userAgent string) string {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req.Header.Set("User-Agent", userAgent)
+
+	app.Session.Put(req.Context(), "user", user)
+	token, _, err := app.Session.Commit(req.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next request of the session is indexed
+	req = sessionRequest("GET", "/", token)
+	req.Header.Set("User-Agent", userAgent)
+	app.trackSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+	return token
+}
+
+// sessionRequest returns a request that uses the session with token.
+func sessionRequest(method, target, token string) *http.Request {
+	req, _ := http.NewRequest(method, target, nil)
+	req.Header.Set("X-Session", token)
+
+	return addContextAndSessionToRequest(req, app)
+}
+
+func addURLParamToRequest(req *http.Request, key, value string) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add(key, value)
+
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+}
+
+func Test_app_trackSession(t *testing.T) {
+	user := data.User{ID: 10, Email: "track@example.com"}
+	token := loginSession(t, user, "Firefox")
+
+	sessions, _ := app.SessionStore.List(user.ID)
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 indexed session; got %d", len(sessions))
+	}
+
+	if sessions[0].ID != sessionstore.ID(token) || sessions[0].UserAgent != "Firefox" || sessions[0].IP != "unknown" {
+		t.Errorf("wrong session indexed: %+v", sessions[0])
+	}
+
+	// the ip is the one lockouts use, a forwarded address from anyone but a
+	// trusted proxy is not shown
+	req := sessionRequest("GET", "/", token)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	app.touchSession(req, user)
+
+	if sessions, _ := app.SessionStore.List(user.ID); len(sessions) != 1 || sessions[0].IP != "192.0.2.1" {
+		t.Errorf("expected the session to be seen from 192.0.2.1; got %+v", sessions)
+	}
+
+	// anonymous sessions are not indexed
+	req, _ = http.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	app.Session.Put(req.Context(), "test", "anonymous")
+	anonymous, _, _ := app.Session.Commit(req.Context())
+
+	req = sessionRequest("GET", "/", anonymous)
+	app.trackSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if sessions, _ := app.SessionStore.List(0); len(sessions) != 0 {
+		t.Errorf("anonymous session was indexed")
+	}
+}
+
+func Test_app_sessions(t *testing.T) {
+	user := data.User{ID: 11, Email: "sessions@example.com"}
+	laptop := loginSession(t, user, "Firefox")
+	phone := loginSession(t, user, "Safari")
+	tablet := loginSession(t, user, "Chrome")
+
+	// the list shows every session, and which one is in use
+	req := sessionRequest("GET", "/user/sessions", laptop)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.Sessions).ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, expected := range []string{"Firefox", "Safari", "Chrome", "This session"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in sessions page", expected)
+		}
+	}
+
+	// revoke one other session
+	req = sessionRequest("POST", "/user/sessions/"+sessionstore.ID(phone)+"/revoke", laptop)
+	req = addURLParamToRequest(req, "sessionID", sessionstore.ID(phone))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.RevokeSession).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/user/sessions" {
+		t.Errorf("revoke: expected redirect to /user/sessions; got %q", loc)
+	}
+
+	if _, found, _ := app.SessionStore.Find(phone); found {
+		t.Error("revoked session still exists")
+	}
+
+	// revoke all others
+	req = sessionRequest("POST", "/user/sessions/revoke-others", laptop)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.RevokeOtherSessions).ServeHTTP(rr, req)
+
+	if _, found, _ := app.SessionStore.Find(tablet); found {
+		t.Error("other session still exists after revoking all others")
+	}
+
+	if _, found, _ := app.SessionStore.Find(laptop); !found {
+		t.Error("current session was revoked with the others")
+	}
+}
+
+func Test_app_logout(t *testing.T) {
+	user := data.User{ID: 12, Email: "logout@example.com"}
+	token := loginSession(t, user, "Firefox")
+
+	req := sessionRequest("POST", "/logout", token)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.Logout).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("expected redirect to /; got %q", loc)
+	}
+
+	if _, found, _ := app.SessionStore.Find(token); found {
+		t.Error("session still exists after logging out")
+	}
+
+	if app.Session.Exists(req.Context(), "user") {
+		t.Error("user is still in the session after logging out")
+	}
+
+	if sessions, _ := app.SessionStore.List(user.ID); len(sessions) != 0 {
+		t.Errorf("expected no sessions after logging out; got %d", len(sessions))
+	}
+}
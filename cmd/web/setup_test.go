@@ -1,18 +1,48 @@
 package main
 
 import (
+	"encoding/gob"
 	"os"
 	"testing"
+	"time"
+	"webapp/locales"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/lockout"
+	"webapp/pkg/mailer"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/sessionstore"
+	"webapp/templates"
 )
 
 var app application
 
 func TestMain(m *testing.M) {
-	app.Session = getSession()
-	pathTpTemplates = "./../../templates"
+	gob.Register(data.User{})
+	gob.Register(time.Time{})
+
+	app.SessionStore = sessionstore.NewMemoryStore()
+	app.Session = getSession(app.SessionStore)
+
+	catalog, err := i18n.Load(locales.FS)
+	if err != nil {
+		panic(err)
+	}
+	app.Catalog = catalog
+
+	cache, err := newTemplateCache(templates.FS, catalog, false)
+	if err != nil {
+		panic(err)
+	}
+	app.Templates = cache
 
 	app.DB = &dbrepo.TestDBRepo{}
+	app.Lockout = lockout.New(lockout.NewMemoryStore())
+	app.RateLimit = ratelimit.NewMemoryStore()
+	app.BaseURL = "http://localhost:8080"
+	app.VerificationKey = []byte("test-verification-key")
+	app.Mailer = &mailer.FileMailer{}
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"webapp/pkg/i18n"
+
+	"golang.org/x/text/language"
+)
+
+// functions are available in every template.
+var functions = template.FuncMap{
+	"humanDate": humanDate,
+	"asset":     asset,
+	"field":     field,
+	// T translates text into the language of the request, like
+	// T "Hello %s" .User.FirstName. Every language gets its own copy of
+	// the templates, with its own T.
+	"T": (*i18n.Printer)(nil).Sprintf,
+}
+
+// humanDate formats t for people, or returns an empty string for the zero time.
+func humanDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Local().Format("02 Jan 2006 at 15:04")
+}
+
+// asset returns the url of a static file, like asset "img/logo.png".
+func asset(file string) string {
+	return path.Join("/static", file)
+}
+
+// formField is one input of a form, as rendered by the "field" partial.
+type formField struct {
+	Form  *Form
+	Name  string
+	Label string
+	Type  string
+	Help  string
+}
+
+// field describes an input for the "field" partial, like
+// field .Form "email" "Email address" "email" "We never share it.". The
+// optional arguments are the input type, text by default, and a help text.
+func field(form *Form, name, label string, extra ...string) formField {
+	f := formField{Form: form, Name: name, Label: label, Type: "text"}
+
+	if len(extra) > 0 && extra[0] != "" {
+		f.Type = extra[0]
+	}
+	if len(extra) > 1 {
+		f.Help = extra[1]
+	}
+
+	return f
+}
+
+// templateCache holds every page parsed together with the layouts and partials,
+// once for every language of the catalog. In dev mode, the templates are parsed
+// again whenever a file has changed.
+type templateCache struct {
+	fsys    fs.FS
+	catalog *i18n.Catalog
+	dev     bool
+
+	mu    sync.RWMutex
+	pages map[language.Tag]map[string]*template.Template
+	// files is the fingerprint of the templates the pages were parsed from
+	files string
+}
+
+// newTemplateCache parses the templates of fsys. Each *.page.gohtml becomes one
+// template, which can use every *.layout.gohtml and *.partial.gohtml. Without a
+// catalog, the templates are only rendered untranslated.
+func newTemplateCache(fsys fs.FS, catalog *i18n.Catalog, dev bool) (*templateCache, error) {
+	c := &templateCache{fsys: fsys, catalog: catalog, dev: dev}
+
+	files, err := c.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := c.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	c.pages, c.files = pages, files
+
+	return c, nil
+}
+
+func (c *templateCache) parse() (map[language.Tag]map[string]*template.Template, error) {
+	pages, err := fs.Glob(c.fsys, "*.page.gohtml")
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	for _, pattern := range []string{"*.layout.gohtml", "*.partial.gohtml"} {
+		files, err := fs.Glob(c.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, files...)
+	}
+
+	parsed := map[language.Tag]map[string]*template.Template{i18n.Source: {}}
+	for _, page := range pages {
+		t, err := template.New(page).Funcs(functions).ParseFS(c.fsys, append([]string{page}, shared...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		// templates can't be cloned once they have been executed, so the
+		// translated copies are made right away
+		if c.catalog != nil {
+			for _, tag := range c.catalog.Tags() {
+				if tag == i18n.Source {
+					continue
+				}
+
+				clone, err := t.Clone()
+				if err != nil {
+					return nil, err
+				}
+
+				if parsed[tag] == nil {
+					parsed[tag] = map[string]*template.Template{}
+				}
+				parsed[tag][page] = clone.Funcs(template.FuncMap{"T": c.catalog.Printer(tag).Sprintf})
+			}
+		}
+
+		parsed[i18n.Source][page] = t
+	}
+
+	return parsed, nil
+}
+
+// fingerprint describes the templates by the name, size and modification time
+// of every file. It changes when a file is added, removed or renamed, even when
+// the file has an older modification time, like one restored from git.
+func (c *templateCache) fingerprint() (string, error) {
+	files, err := fs.Glob(c.fsys, "*.gohtml")
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		info, err := fs.Stat(c.fsys, file)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return b.String(), nil
+}
+
+// reloadIfChanged parses the templates again when a file was added, removed or
+// changed since they were last parsed. Broken templates are logged, and the old ones kept, so the
+// server keeps running while a template is being edited.
+func (c *templateCache) reloadIfChanged() {
+	files, err := c.fingerprint()
+	if err != nil {
+		log.Println("error checking templates:", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if files == c.files {
+		return
+	}
+	c.files = files
+
+	pages, err := c.parse()
+	if err != nil {
+		log.Println("error parsing templates:", err)
+		return
+	}
+	c.pages = pages
+}
+
+// get returns the parsed page called name, in the language lang. Languages
+// without templates get the untranslated ones.
+func (c *templateCache) get(name string, lang language.Tag) (*template.Template, error) {
+	if c.dev {
+		c.reloadIfChanged()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pages, ok := c.pages[lang]
+	if !ok {
+		pages = c.pages[i18n.Source]
+	}
+
+	t, ok := pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s does not exist", name)
+	}
+
+	return t, nil
+}
+
+// execute renders the page called name in the language lang into w. The page
+// is rendered into a buffer first, so a failing template doesn't send half a
+// page.
+func (c *templateCache) execute(w http.ResponseWriter, name string, lang language.Tag, data any) error {
+	t, err := c.get(name, lang)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+
+	return err
+}
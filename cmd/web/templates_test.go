@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/i18n"
+	"webapp/templates"
+)
+
+func Test_humanDate(t *testing.T) {
+	if got := humanDate(time.Time{}); got != "" {
+		t.Errorf("expected empty string for zero time; got %q", got)
+	}
+
+	tm := time.Date(2022, 3, 17, 10, 15, 0, 0, time.Local)
+	if got := humanDate(tm); got != "17 Mar 2022 at 10:15" {
+		t.Errorf("wrong date; got %q", got)
+	}
+}
+
+func Test_asset(t *testing.T) {
+	var tests = []struct {
+		file     string
+		expected string
+	}{
+		{"img/logo.png", "/static/img/logo.png"},
+		{"/img/logo.png", "/static/img/logo.png"},
+		{"../main.go", "/main.go"},
+	}
+
+	for _, e := range tests {
+		if got := asset(e.file); got != e.expected {
+			t.Errorf("asset(%q): expected %q; got %q", e.file, e.expected, got)
+		}
+	}
+}
+
+func Test_templateCache_pages(t *testing.T) {
+	for _, page := range []string{"home.page.gohtml", "profile.page.gohtml", "sessions.page.gohtml"} {
+		if _, err := app.Templates.get(page, i18n.Source); err != nil {
+			t.Errorf("expected %s in the cache: %s", page, err)
+		}
+	}
+}
+
+func Test_templateCache_devReload(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTemplate(t, dir, "base.layout.gohtml", `{{ define "base" }}<main>{{ template "content" . }}</main>{{ end }}`)
+	writeTemplate(t, dir, "greeting.partial.gohtml", `{{ define "greeting" }}Hello{{ end }}`)
+	writeTemplate(t, dir, "home.page.gohtml", `{{ template "base" . }}{{ define "content" }}{{ template "greeting" }} one{{ end }}`)
+
+	cache, err := newTemplateCache(os.DirFS(dir), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectRendered(t, cache, "<main>Hello one</main>")
+
+	// an edited page is picked up by the next render
+	writeTemplate(t, dir, "home.page.gohtml", `{{ template "base" . }}{{ define "content" }}{{ template "greeting" }} two{{ end }}`)
+	expectRendered(t, cache, "<main>Hello two</main>")
+
+	// a broken edit keeps the last working templates
+	writeTemplate(t, dir, "home.page.gohtml", `{{ template "base" . }}{{ define "content" }}{{ $missing }}{{ end }}`)
+	expectRendered(t, cache, "<main>Hello two</main>")
+}
+
+func Test_templateCache_devReload_fileSet(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTemplate(t, dir, "base.layout.gohtml", `{{ define "base" }}<main>{{ template "content" . }}</main>{{ end }}`)
+	writeTemplate(t, dir, "home.page.gohtml", `{{ template "base" . }}{{ define "content" }}home{{ end }}`)
+
+	cache, err := newTemplateCache(os.DirFS(dir), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a page restored with an old modification time is still picked up
+	about := filepath.Join(dir, "about.page.gohtml")
+	if err := os.WriteFile(about, []byte(`{{ template "base" . }}{{ define "content" }}about{{ end }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(about, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	if err := cache.execute(rr, "about.page.gohtml", i18n.Source, nil); err != nil {
+		t.Fatalf("expected the new page: %s", err)
+	}
+
+	// and a removed page is gone
+	if err := os.Remove(about); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.execute(httptest.NewRecorder(), "about.page.gohtml", i18n.Source, nil); err == nil {
+		t.Error("expected the removed page to be gone")
+	}
+}
+
+func Test_templateCache_embeddedNoReload(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTemplate(t, dir, "home.page.gohtml", `one`)
+
+	cache, err := newTemplateCache(os.DirFS(dir), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTemplate(t, dir, "home.page.gohtml", `two`)
+	expectRendered(t, cache, "one")
+}
+
+// writeTemplate writes a template into dir, with a modification time after
+// any earlier write, so the change is noticed on file systems with a coarse
+// clock.
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writes++
+	mtime := time.Now().Add(time.Duration(writes) * time.Second)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var writes int
+
+func expectRendered(t *testing.T, cache *templateCache, expected string) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	if err := cache.execute(rr, "home.page.gohtml", i18n.Source, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.TrimSpace(rr.Body.String()); got != expected {
+		t.Errorf("expected %q; got %q", expected, got)
+	}
+}
+
+func Test_fieldPartial(t *testing.T) {
+	form := NewForm(url.Values{"email": {"jane.example.com"}, "password": {"secret"}})
+	form.IsEmail("email")
+	form.StrongPassword("password", 8)
+
+	tmpl, err := template.New("form").Funcs(functions).ParseFS(templates.FS, "form.partial.gohtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	render := func(f formField) string {
+		buf.Reset()
+		if err := tmpl.ExecuteTemplate(&buf, "field", f); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	html := render(field(form, "email", "Email address", "email", "We never share it."))
+	for _, expected := range []string{`type="email"`, "is-invalid", `value="jane.example.com"`, "Invalid email address", "We never share it."} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %q in %s", expected, html)
+		}
+	}
+
+	// passwords are never sent back
+	html = render(field(form, "password", "Password", "password"))
+	if strings.Contains(html, "secret") || !strings.Contains(html, "is-invalid") {
+		t.Errorf("wrong password field: %s", html)
+	}
+
+	html = render(field(NewForm(url.Values{}), "first_name", "First name"))
+	if !strings.Contains(html, `type="text"`) || strings.Contains(html, "is-invalid") {
+		t.Errorf("wrong text field: %s", html)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxUploadFileSize is the largest file that can be uploaded.
+	maxUploadFileSize = 5 << 20
+	// maxUploadSize is the largest request body an upload can have, with
+	// every file in it.
+	maxUploadSize = 10 << 20
+	// maxFileNameLength is the length original file names are cut to.
+	maxFileNameLength = 255
+)
+
+// allowedImageTypes maps the content types that can be uploaded to the
+// extension the file is stored with.
+var allowedImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UploadedFile describes one stored upload. FileName is the random name it is
+// stored under, OriginalFileName the name the client sent.
+type UploadedFile struct {
+	FileName         string
+	OriginalFileName string
+	ContentType      string
+	FileSize         int64
+}
+
+// uploadError is an upload that was rejected, its message can be shown to the
+// user. It is kept as a format and its args, so it can be translated.
+type uploadError struct {
+	format string
+	args   []any
+}
+
+func uploadErrorf(format string, args ...any) *uploadError {
+	return &uploadError{format: format, args: args}
+}
+
+func (e *uploadError) Error() string {
+	return fmt.Sprintf(e.format, e.args...)
+}
+
+// uploadFiles stores the image files of a multipart request in uploadDir. The
+// content of each file is sniffed, only the allowedImageTypes are accepted.
+// Files are stored under random names, and appear in uploadDir only once they
+// are completely written. If one file is rejected, none are kept.
+func (app *application) uploadFiles(r *http.Request, uploadDir string) ([]*UploadedFile, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxUploadSize)
+
+	err := r.ParseMultipartForm(maxUploadFileSize)
+	if err != nil {
+		return nil, uploadErrorf("The upload could not be read, it can be at most %d MB in total", maxUploadSize>>20)
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	var uploadedFiles []*UploadedFile
+
+	for _, fHeaders := range r.MultipartForm.File {
+		for _, hdr := range fHeaders {
+			uploadedFile, err := storeUpload(hdr, uploadDir)
+			if err != nil {
+				removeUploads(uploadDir, uploadedFiles)
+				return nil, err
+			}
+
+			uploadedFiles = append(uploadedFiles, uploadedFile)
+		}
+	}
+
+	return uploadedFiles, nil
+}
+
+// storeUpload checks one uploaded file, and writes it to uploadDir.
+func storeUpload(hdr *multipart.FileHeader, uploadDir string) (*UploadedFile, error) {
+	originalName := originalFileName(hdr.Filename)
+
+	if hdr.Size > maxUploadFileSize {
+		return nil, uploadErrorf("%s is too big, images can be at most %d MB", originalName, maxUploadFileSize>>20)
+	}
+
+	infile, err := hdr.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+
+	// the type is decided by the content, not by the name or the header the client sent
+	head := make([]byte, 512)
+	n, err := io.ReadFull(infile, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, uploadErrorf("%s is empty or can't be read", originalName)
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return nil, uploadErrorf("%s is not a png, jpeg, gif or webp image", originalName)
+	}
+
+	if _, err := infile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	name, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	name += ext
+
+	size, err := writeFileAtomic(filepath.Join(uploadDir, name), io.LimitReader(infile, maxUploadFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if size > maxUploadFileSize {
+		_ = os.Remove(filepath.Join(uploadDir, name))
+		return nil, uploadErrorf("%s is too big, images can be at most %d MB", originalName, maxUploadFileSize>>20)
+	}
+
+	return &UploadedFile{
+		FileName:         name,
+		OriginalFileName: originalName,
+		ContentType:      contentType,
+		FileSize:         size,
+	}, nil
+}
+
+// writeFileAtomic writes r to a temporary file next to name, and renames it to
+// name once everything is written, so readers never see a partial file.
+func writeFileAtomic(name string, r io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// removeUploads deletes stored uploads that are not used after all.
+func removeUploads(uploadDir string, files []*UploadedFile) {
+	for _, f := range files {
+		if err := os.Remove(filepath.Join(uploadDir, f.FileName)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// originalFileName returns the base name of a file name sent by a client, cut
+// to a length that fits the database.
+func originalFileName(name string) string {
+	// clients may send windows paths
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		return "image"
+	}
+
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = string(runes[:maxFileNameLength])
+	}
+
+	return name
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// multipartRequest returns an upload request with one file per name in files.
+func multipartRequest(t *testing.T, files map[string][]byte) *http.Request {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+
+	for name, content := range files {
+		w, err := mw.CreateFormFile("image", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(content)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/user/upload-profile-pic", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return req
+}
+
+func Test_app_uploadFiles_rejected(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooBig := append(append([]byte{}, png...), make([]byte, maxUploadFileSize)...)
+
+	var tests = []struct {
+		name          string
+		files         map[string][]byte
+		expectedError string
+	}{
+		{"text", map[string][]byte{"notes.png": []byte("just some text")}, "notes.png is not a png, jpeg, gif or webp image"},
+		{"html", map[string][]byte{"page.gif": []byte("<html><script>alert(1)</script></html>")}, "page.gif is not a png"},
+		{"empty", map[string][]byte{"empty.png": {}}, "empty.png is empty"},
+		{"file-too-big", map[string][]byte{"big.png": tooBig}, "big.png is too big"},
+		{"one-bad-file", map[string][]byte{"good.png": png, "bad.png": []byte("text")}, "bad.png is not a png"},
+	}
+
+	for _, e := range tests {
+		uploadDir := t.TempDir()
+
+		_, err := app.uploadFiles(multipartRequest(t, e.files), uploadDir)
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+			continue
+		}
+
+		if _, ok := err.(*uploadError); !ok || !strings.Contains(err.Error(), e.expectedError) {
+			t.Errorf("%s: expected upload error %q; got %v", e.name, e.expectedError, err)
+		}
+
+		if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+			t.Errorf("%s: expected no files to be kept; got %d", e.name, len(entries))
+		}
+	}
+}
+
+func Test_app_uploadFiles_totalSize(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every file is small enough, but together they are not
+	padded := append(append([]byte{}, png...), make([]byte, maxUploadFileSize-len(png)-1)...)
+	files := map[string][]byte{"a.png": padded, "b.png": padded, "c.png": padded}
+
+	uploadDir := t.TempDir()
+	_, err = app.uploadFiles(multipartRequest(t, files), uploadDir)
+	if _, ok := err.(*uploadError); !ok {
+		t.Errorf("expected an upload error; got %v", err)
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+
+	return n, err
+}
+
+func Test_app_routes_uploadTooBig(t *testing.T) {
+	// the csrf middleware reads the form before the upload handler does, the
+	// body must already be capped then
+	files := map[string][]byte{"big.png": make([]byte, 2*maxUploadSize)}
+	req := multipartRequest(t, files)
+	body := &countingReader{r: req.Body}
+	req.Body = io.NopCloser(body)
+	rr := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400; got %d", rr.Code)
+	}
+
+	if body.read > maxUploadSize+1 {
+		t.Errorf("read %d bytes of the body, more than %d", body.read, maxUploadSize)
+	}
+}
+
+func Test_app_uploadFiles_names(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadDir := t.TempDir()
+	files := map[string][]byte{"../../evil.png": png}
+
+	uploaded, err := app.uploadFiles(multipartRequest(t, files), uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded[0].OriginalFileName != "evil.png" {
+		t.Errorf("expected the base name as original name; got %q", uploaded[0].OriginalFileName)
+	}
+
+	if strings.Contains(uploaded[0].FileName, "evil") || filepath.Ext(uploaded[0].FileName) != ".png" {
+		t.Errorf("expected a random name with the extension of the content; got %q", uploaded[0].FileName)
+	}
+
+	// only the stored file is left, no temporary files
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 1 || entries[0].Name() != uploaded[0].FileName {
+		t.Errorf("expected only %s in the upload dir; got %v", uploaded[0].FileName, entries)
+	}
+
+	// the same file again gets another name
+	again, err := app.uploadFiles(multipartRequest(t, files), uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again[0].FileName == uploaded[0].FileName {
+		t.Error("two uploads were stored under the same name")
+	}
+}
+
+func Test_originalFileName(t *testing.T) {
+	var tests = []struct {
+		name     string
+		expected string
+	}{
+		{"photo.png", "photo.png"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\jane\photo.jpg`, "photo.jpg"},
+		{"", "image"},
+		{"/", "image"},
+		{strings.Repeat("a", 300), strings.Repeat("a", maxFileNameLength)},
+	}
+
+	for _, e := range tests {
+		if got := originalFileName(e.name); got != e.expected {
+			t.Errorf("originalFileName(%q): expected %q; got %q", e.name, e.expected, got)
+		}
+	}
+}
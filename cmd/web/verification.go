@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"webapp/pkg/data"
+	"webapp/pkg/verification"
+)
+
+// sendEmailVerification emails user a link to confirm their email address, in
+// the language they chose.
+func (app *application) sendEmailVerification(user *data.User) error {
+	return app.Mailer.Send(verification.Message(app.userPrinter(user), app.VerificationKey, app.BaseURL, user))
+}
+
+// VerifyEmail asks logged-in users with an unverified email address to confirm it.
+func (app *application) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.Session.Get(r.Context(), "user").(data.User)
+	if !ok {
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("Log in first!"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if user.EmailVerified() {
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	_ = app.render(w, r, "verify-email.page.gohtml", &TemplateData{})
+}
+
+// ConfirmEmail is where the link of the verification email leads to.
+func (app *application) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	user, loggedIn := app.Session.Get(r.Context(), "user").(data.User)
+
+	id, email, err := verification.Parse(app.VerificationKey, r.URL.Query().Get("token"))
+	if err == nil {
+		var verified bool
+		verified, err = app.DB.VerifyUserEmail(id, email)
+		if err == nil && !verified {
+			err = verification.ErrInvalid
+		}
+	}
+
+	if err != nil {
+		if err != verification.ErrInvalid {
+			log.Println(err)
+		}
+
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("This verification link is invalid or has expired."))
+		if loggedIn {
+			http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		}
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("Thank you, your email address is confirmed!"))
+
+	if !loggedIn {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// refresh the session variable `user`
+	if user.ID == id {
+		if updatedUser, err := app.DB.GetUser(id); err == nil {
+			app.Session.Put(r.Context(), "user", *updatedUser)
+		}
+	}
+
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// ResendVerification sends a new verification email to the logged-in user.
+func (app *application) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.Session.Get(r.Context(), "user").(data.User)
+	if !ok {
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("Log in first!"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if user.EmailVerified() {
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.sendEmailVerification(&user); err != nil {
+		log.Println(err)
+		app.Session.Put(r.Context(), "error", printer(r).Sprintf("We could not send the email, please try again later."))
+		http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", printer(r).Sprintf("We have sent you a new link, please check your email."))
+	http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+}
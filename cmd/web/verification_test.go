@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+	"webapp/pkg/verification"
+)
+
+var verificationLink = regexp.MustCompile(`/verify-email/confirm\?token=([A-Za-z0-9_.%-]+)`)
+
+func Test_app_confirmEmail(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	dir := t.TempDir()
+	app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	user, _ := app.DB.GetUser(3)
+	if err := app.sendEmailVerification(user); err != nil {
+		t.Fatal(err)
+	}
+
+	mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(mails) != 1 {
+		t.Fatalf("expected one mail; got %d", len(mails))
+	}
+	content, _ := os.ReadFile(mails[0])
+
+	match := verificationLink.FindStringSubmatch(string(content))
+	if match == nil {
+		t.Fatalf("no verification link in mail: %s", content)
+	}
+
+	var tests = []struct {
+		name        string
+		query       string
+		sessionUser *data.User
+		expectedLoc string
+		expectFlash bool
+	}{
+		{"valid-link", match[1], nil, "/", true},
+		{"valid-link-logged-in", match[1], user, "/user/profile", true},
+		{"old-email", verification.Sign(app.VerificationKey, 3, "old@example.com", time.Now().Add(time.Hour)), nil, "/", false},
+		{"invalid-link", "nope", user, "/verify-email", false},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/verify-email/confirm?token="+e.query, nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.sessionUser != nil {
+			app.Session.Put(req.Context(), "user", *e.sessionUser)
+		}
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(app.ConfirmEmail).ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected redirect to %q; got %q", e.name, e.expectedLoc, loc)
+		}
+
+		if flash := app.Session.GetString(req.Context(), "flash"); (flash != "") != e.expectFlash {
+			t.Errorf("%s: expected flash %v; got %q", e.name, e.expectFlash, flash)
+		}
+	}
+}
+
+func Test_app_resendVerification(t *testing.T) {
+	oldMailer := app.Mailer
+	defer func() { app.Mailer = oldMailer }()
+
+	var tests = []struct {
+		name          string
+		user          *data.User
+		expectedLoc   string
+		expectedMails int
+	}{
+		{"unverified", &data.User{ID: 3, FirstName: "John", Email: "john@example.com"}, "/verify-email", 1},
+		{"verified", &data.User{ID: 1, Email: "admin@example.com", EmailVerifiedAt: time.Now()}, "/user/profile", 0},
+		{"not-logged-in", nil, "/", 0},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		app.Mailer = &mailer.FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+		req, _ := http.NewRequest("POST", "/verify-email/resend", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.user != nil {
+			app.Session.Put(req.Context(), "user", *e.user)
+		}
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(app.ResendVerification).ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected redirect to %q; got %q", e.name, e.expectedLoc, loc)
+		}
+
+		mails, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(mails) != e.expectedMails {
+			t.Errorf("%s: expected %d mails; got %d", e.name, e.expectedMails, len(mails))
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package locales embeds the translations of the application into the binary.
+package locales
+
+import "embed"
+
+// FS holds one JSON file per language, named after its tag, like de.json. Each
+// maps English messages to translated ones, see the i18n package.
+//
+//go:embed *.json
+var FS embed.FS
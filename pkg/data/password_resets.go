@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+// PasswordReset is the type for a password reset token sent by email. Only a
+// hash of the token is kept, and a token can be used once, before ExpiresAt.
+type PasswordReset struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
@@ -0,0 +1,17 @@
+package data
+
+import "time"
+
+// RefreshToken is the type for a stored refresh token. Only a hash of the
+// signed token is kept, every token issued by rotating another one shares
+// the FamilyID of the token it replaced.
+type RefreshToken struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	TokenHash string    `json:"-"`
+	FamilyID  string    `json:"family_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"-"`
+	RevokedAt time.Time `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
@@ -2,11 +2,37 @@ package data
 
 import "time"
 
-// UserImage is the type for user profile images.
+// UserImage is the type for user profile images. FileName is the name the
+// image is stored under, OriginalFileName the name it was uploaded with.
 type UserImage struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	FileName  string    `json:"file_name"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	ID               int            `json:"id"`
+	UserID           int            `json:"user_id"`
+	FileName         string         `json:"file_name"`
+	OriginalFileName string         `json:"original_file_name"`
+	Variants         []ImageVariant `json:"variants"`
+	CreatedAt        time.Time      `json:"-"`
+	UpdatedAt        time.Time      `json:"-"`
+}
+
+// ImageVariant is a scaled copy of a user image, like a thumbnail.
+type ImageVariant struct {
+	ID          int       `json:"id"`
+	UserImageID int       `json:"user_image_id"`
+	Name        string    `json:"name"`
+	FileName    string    `json:"file_name"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// Variant returns the file name of the variant called name, or the file name
+// of the image itself if there is no such variant.
+func (i UserImage) Variant(name string) string {
+	for _, v := range i.Variants {
+		if v.Name == name {
+			return v.FileName
+		}
+	}
+
+	return i.FileName
 }
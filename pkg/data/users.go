@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/xml"
 	"errors"
 	"time"
 
@@ -9,15 +10,23 @@ import (
 
 // User describes the data for the User type.
 type User struct {
-	ID         int       `json:"id"`
-	FirstName  string    `json:"first_name"`
-	LastName   string    `json:"last_name"`
-	Email      string    `json:"email"`
-	Password   string    `json:"-"`
-	IsAdmin    int       `json:"is_admin"`
-	CreatedAt  time.Time `json:"-"`
-	UpdatedAt  time.Time `json:"-"`
-	ProfilePic UserImage `json:"-"`
+	XMLName         xml.Name  `json:"-" xml:"user"`
+	ID              int       `json:"id" xml:"id"`
+	FirstName       string    `json:"first_name" xml:"first_name"`
+	LastName        string    `json:"last_name" xml:"last_name"`
+	Email           string    `json:"email" xml:"email"`
+	Password        string    `json:"-" xml:"-"`
+	IsAdmin         int       `json:"is_admin" xml:"is_admin"`
+	Locale          string    `json:"-" xml:"-"`
+	EmailVerifiedAt time.Time `json:"-" xml:"-"`
+	CreatedAt       time.Time `json:"-" xml:"-"`
+	UpdatedAt       time.Time `json:"-" xml:"-"`
+	ProfilePic      UserImage `json:"-" xml:"-"`
+}
+
+// EmailVerified reports whether the user has confirmed their email address.
+func (u *User) EmailVerified() bool {
+	return !u.EmailVerifiedAt.IsZero()
 }
 
 // PasswordMatches uses Go's bcrypt package to compare a user supplied password
@@ -0,0 +1,43 @@
+// Package denylist keeps track of revoked tokens by their id (jti), until the
+// tokens would have expired anyway.
+package denylist
+
+import (
+	"log"
+	"time"
+)
+
+// Store is a denylist of revoked token ids.
+type Store interface {
+	// Revoke adds a token id to the denylist, until expiresAt.
+	Revoke(jti string, expiresAt time.Time) error
+	// IsRevoked reports whether a token id is on the denylist.
+	IsRevoked(jti string) (bool, error)
+	// DeleteExpired removes entries whose token has expired.
+	DeleteExpired() error
+}
+
+// StartCleanup removes expired entries from the store every interval, until the
+// returned stop function is called.
+func StartCleanup(store Store, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := store.DeleteExpired(); err != nil {
+					log.Println("error cleaning up token denylist:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,53 @@
+package denylist
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that lives in memory, it is only suitable for a single instance.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[jti] = expiresAt
+
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.entries[jti]
+	if !ok {
+		return false, nil
+	}
+
+	return time.Now().Before(expiresAt), nil
+}
+
+func (s *MemoryStore) DeleteExpired() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiresAt := range s.entries {
+		if !now.Before(expiresAt) {
+			delete(s.entries, jti)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package denylist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	_ = store.Revoke("active", time.Now().Add(time.Hour))
+	_ = store.Revoke("expired", time.Now().Add(-time.Minute))
+
+	var tests = []struct {
+		jti     string
+		revoked bool
+	}{
+		{"active", true},
+		{"expired", false},
+		{"unknown", false},
+	}
+
+	for _, e := range tests {
+		revoked, err := store.IsRevoked(e.jti)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", e.jti, err)
+		}
+
+		if revoked != e.revoked {
+			t.Errorf("%s: expected revoked to be %v; got %v", e.jti, e.revoked, revoked)
+		}
+	}
+
+	_ = store.DeleteExpired()
+	if len(store.entries) != 1 {
+		t.Errorf("expected 1 entry after cleanup; got %d", len(store.entries))
+	}
+}
+
+func TestStartCleanup(t *testing.T) {
+	store := NewMemoryStore()
+	_ = store.Revoke("expired", time.Now().Add(-time.Minute))
+
+	stop := StartCleanup(store, 10*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		store.mu.RLock()
+		n := len(store.entries)
+		store.mu.RUnlock()
+
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("expired entry was not cleaned up")
+}
@@ -0,0 +1,58 @@
+package denylist
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+// PostgresStore is a Store kept in the revoked_tokens table, shared by every instance.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func (s *PostgresStore) Revoke(jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into revoked_tokens (jti, expires_at) values ($1, $2)
+		on conflict (jti) do nothing`
+
+	_, err := s.DB.ExecContext(ctx, stmt, jti, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) IsRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select exists(select 1 from revoked_tokens where jti = $1 and expires_at > $2)`
+
+	var revoked bool
+	err := s.DB.QueryRowContext(ctx, query, jti, time.Now()).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+func (s *PostgresStore) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from revoked_tokens where expires_at <= $1`
+
+	_, err := s.DB.ExecContext(ctx, stmt, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package i18n translates the messages of the application. Messages are
+// looked up by their English text, the way gettext does it, so code reads the
+// same as before and a missing translation falls back to English. Translations
+// are kept in one JSON file per language, named after its BCP 47 tag, like
+// de.json, which maps English messages to translated ones. Messages can hold
+// fmt verbs, which are filled in after translating.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Source is the language messages are written in.
+var Source = language.English
+
+// Catalog holds the translations of every language.
+type Catalog struct {
+	tags     []language.Tag
+	matcher  language.Matcher
+	messages map[language.Tag]map[string]string
+}
+
+// Load reads every *.json file of fsys into a catalog. The source language is
+// always supported, and doesn't need a file.
+func Load(fsys fs.FS) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		tags:     []language.Tag{Source},
+		messages: map[language.Tag]map[string]string{Source: {}},
+	}
+
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("i18n: %s is not named after a language: %w", file, err)
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := map[string]string{}
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file, err)
+		}
+
+		// a translation with other verbs than its message would print garbage
+		for key, message := range messages {
+			if message != "" && !equalVerbs(key, message) {
+				return nil, fmt.Errorf("i18n: %s: %q doesn't have the verbs of %q", file, message, key)
+			}
+		}
+
+		if tag != Source {
+			c.tags = append(c.tags, tag)
+		}
+		c.messages[tag] = messages
+	}
+
+	c.matcher = language.NewMatcher(c.tags)
+
+	return c, nil
+}
+
+// Tags returns the supported languages, the source language first.
+func (c *Catalog) Tags() []language.Tag {
+	return c.tags
+}
+
+// Match returns the supported language that suits the preferences best. Each
+// preference is a language tag, or the value of an Accept-Language header,
+// the first one that matches a supported language wins. Without a match, it
+// returns the source language.
+func (c *Catalog) Match(preferences ...string) language.Tag {
+	for _, p := range preferences {
+		tags, _, err := language.ParseAcceptLanguage(p)
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+
+		_, index, confidence := c.matcher.Match(tags...)
+		if confidence != language.No {
+			return c.tags[index]
+		}
+	}
+
+	return Source
+}
+
+// Supported reports whether lang is a tag of a supported language.
+func (c *Catalog) Supported(lang string) bool {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return false
+	}
+
+	_, ok := c.messages[tag]
+
+	return ok
+}
+
+// Printer returns the printer of tag, which should be one of Tags.
+func (c *Catalog) Printer(tag language.Tag) *Printer {
+	return &Printer{tag: tag, messages: c.messages[tag]}
+}
+
+// Printer translates messages into one language. A nil printer prints the
+// messages as they are.
+type Printer struct {
+	tag      language.Tag
+	messages map[string]string
+}
+
+// Tag returns the language of the printer.
+func (p *Printer) Tag() language.Tag {
+	if p == nil {
+		return Source
+	}
+
+	return p.tag
+}
+
+// Sprintf translates key, and formats it with args.
+func (p *Printer) Sprintf(key string, args ...any) string {
+	message := key
+	if p != nil {
+		if m, ok := p.messages[key]; ok && m != "" {
+			message = m
+		}
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
+
+// Name returns the name of a language in that language, like Deutsch for de.
+func Name(tag language.Tag) string {
+	if name := display.Self.Name(tag); name != "" {
+		return name
+	}
+
+	return tag.String()
+}
+
+// verb matches the fmt verbs of a message.
+var verb = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// equalVerbs reports whether a and b have the same fmt verbs, in the same order.
+func equalVerbs(a, b string) bool {
+	return strings.Join(verb.FindAllString(a, -1), " ") == strings.Join(verb.FindAllString(b, -1), " ")
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries p.
+func NewContext(ctx context.Context, p *Printer) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the printer of ctx, or nil when there is none, which
+// prints messages untranslated.
+func FromContext(ctx context.Context) *Printer {
+	p, _ := ctx.Value(contextKey{}).(*Printer)
+
+	return p
+}
@@ -0,0 +1,120 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/text/language"
+)
+
+func testCatalog(t *testing.T) *Catalog {
+	t.Helper()
+
+	c, err := Load(fstest.MapFS{
+		"de.json": {Data: []byte(`{"Hello": "Hallo", "Hello %s, you have %d messages": "Hallo %s, du hast %d Nachrichten", "Untranslated": ""}`)},
+		"fr.json": {Data: []byte(`{"Hello": "Bonjour"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestLoad(t *testing.T) {
+	c := testCatalog(t)
+
+	if tags := c.Tags(); len(tags) != 3 || tags[0] != language.English {
+		t.Errorf("expected english and two translations; got %v", tags)
+	}
+
+	var tests = []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"not-a-language", fstest.MapFS{"messages.json": {Data: []byte(`{}`)}}},
+		{"invalid-json", fstest.MapFS{"de.json": {Data: []byte(`{"Hello": `)}}},
+		{"other-verbs", fstest.MapFS{"de.json": {Data: []byte(`{"%d users": "%s Benutzer"}`)}}},
+		{"missing-verb", fstest.MapFS{"de.json": {Data: []byte(`{"Hello %s": "Hallo"}`)}}},
+	}
+
+	for _, e := range tests {
+		if _, err := Load(e.fsys); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestCatalog_Match(t *testing.T) {
+	c := testCatalog(t)
+
+	var tests = []struct {
+		name        string
+		preferences []string
+		expected    language.Tag
+	}{
+		{"none", nil, language.English},
+		{"accept-language", []string{"fr-CH, fr;q=0.9, en;q=0.8"}, language.French},
+		{"quality", []string{"en;q=0.5, de;q=0.9"}, language.German},
+		{"region", []string{"de-AT"}, language.German},
+		{"unsupported", []string{"ja, zh"}, language.English},
+		{"first-wins", []string{"fr", "de"}, language.French},
+		{"skips-empty-and-invalid", []string{"", "!!", "de"}, language.German},
+		{"skips-unsupported", []string{"ja", "de"}, language.German},
+	}
+
+	for _, e := range tests {
+		if got := c.Match(e.preferences...); got != e.expected {
+			t.Errorf("%s: expected %s; got %s", e.name, e.expected, got)
+		}
+	}
+
+	if !c.Supported("de") || !c.Supported("en") || c.Supported("ja") || c.Supported("!!") {
+		t.Error("wrong supported languages")
+	}
+}
+
+func TestPrinter_Sprintf(t *testing.T) {
+	c := testCatalog(t)
+	de := c.Printer(language.German)
+
+	var tests = []struct {
+		name     string
+		printer  *Printer
+		key      string
+		args     []any
+		expected string
+	}{
+		{"translated", de, "Hello", nil, "Hallo"},
+		{"with-args", de, "Hello %s, you have %d messages", []any{"Jane", 3}, "Hallo Jane, du hast 3 Nachrichten"},
+		{"missing", de, "Goodbye", nil, "Goodbye"},
+		{"empty-translation", de, "Untranslated", nil, "Untranslated"},
+		{"no-args-keeps-percent", de, "100% sure", nil, "100% sure"},
+		{"source", c.Printer(language.English), "Hello", nil, "Hello"},
+		{"nil", nil, "Hello %s", []any{"Jane"}, "Hello Jane"},
+	}
+
+	for _, e := range tests {
+		if got := e.printer.Sprintf(e.key, e.args...); got != e.expected {
+			t.Errorf("%s: expected %q; got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if p := FromContext(context.Background()); p != nil || p.Tag() != language.English {
+		t.Error("expected a nil printer for english without a printer in the context")
+	}
+
+	de := testCatalog(t).Printer(language.German)
+	if p := FromContext(NewContext(context.Background(), de)); p != de {
+		t.Error("expected the printer of the context")
+	}
+}
+
+func TestName(t *testing.T) {
+	if got := Name(language.German); got != "Deutsch" {
+		t.Errorf("expected Deutsch; got %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// errNoOrientation is returned for images without an EXIF orientation.
+var errNoOrientation = errors.New("imaging: no orientation")
+
+// orientationTag is the EXIF tag of the orientation of an image.
+const orientationTag = 0x0112
+
+// readOrientation returns the EXIF orientation of a jpeg image, read from the
+// APP1 segment that comes before the image data.
+func readOrientation(r io.Reader) (int, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return 0, err
+	}
+
+	if soi != [2]byte{0xFF, 0xD8} {
+		return 0, errNoOrientation
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return 0, err
+		}
+
+		if marker[0] != 0xFF {
+			return 0, errNoOrientation
+		}
+
+		// the image data starts, metadata comes before it
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return 0, errNoOrientation
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return 0, errNoOrientation
+		}
+
+		if marker[1] != 0xE1 {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return 0, err
+		}
+
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+	}
+}
+
+// tiffOrientation returns the orientation from the first IFD of the TIFF
+// structure EXIF data is stored in.
+func tiffOrientation(b []byte) (int, error) {
+	if len(b) < 8 {
+		return 0, errNoOrientation
+	}
+
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, errNoOrientation
+	}
+
+	if order.Uint16(b[2:]) != 42 {
+		return 0, errNoOrientation
+	}
+
+	offset := int(order.Uint32(b[4:]))
+	if offset < 8 || offset+2 > len(b) {
+		return 0, errNoOrientation
+	}
+
+	entries := int(order.Uint16(b[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(b) {
+			break
+		}
+
+		if order.Uint16(b[entry:]) == orientationTag {
+			o := int(order.Uint16(b[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0, errNoOrientation
+			}
+
+			return o, nil
+		}
+	}
+
+	return 0, errNoOrientation
+}
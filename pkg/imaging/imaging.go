@@ -0,0 +1,167 @@
+// Package imaging turns uploaded images into images that are safe to serve:
+// decoded, turned upright, scaled down and encoded again, which leaves the
+// metadata of the upload, like EXIF and GPS positions, behind.
+package imaging
+
+import (
+	"errors"
+	"image"
+	_ "image/gif" // registers the gif decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the webp decoder
+)
+
+// MaxPixels is the largest image, in pixels, that is decoded. It stops small
+// files that decode into huge images.
+var MaxPixels = 50_000_000
+
+// ErrTooLarge is returned for images of more than MaxPixels pixels.
+var ErrTooLarge = errors.New("imaging: image has too many pixels")
+
+// jpegQuality is the quality jpeg images are encoded with.
+const jpegQuality = 85
+
+// Normalize decodes an image, scales it down to fit in maxSize x maxSize and
+// turns it upright, as described by its EXIF orientation. It returns the
+// image, and the name of the format it was decoded from.
+func Normalize(r io.ReadSeeker, maxSize int) (*image.NRGBA, string, error) {
+	orientation := 1
+	if o, err := readOrientation(r); err == nil {
+		orientation = o
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// scaling first makes turning the image cheap, the bounds are square so
+	// the order doesn't change the result
+	return orient(fit(img, maxSize), orientation), format, nil
+}
+
+// Thumbnail crops the center square out of img, and scales it to size x size.
+func Thumbnail(img image.Image, size int) *image.NRGBA {
+	b := img.Bounds()
+
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	square := image.Rect(x, y, x+side, y+side)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, square, draw.Src, nil)
+
+	return dst
+}
+
+// Encode writes img in the format it is best kept in: jpeg for jpeg images,
+// and png for everything else, because gif and webp images can be transparent.
+func Encode(w io.Writer, img image.Image, format string) error {
+	if format == "jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+
+	return png.Encode(w, img)
+}
+
+// Extension returns the file extension of images of format, as written by Encode.
+func Extension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+
+	return ".png"
+}
+
+// fit scales img down to fit in maxSize x maxSize, keeping its aspect ratio.
+// Smaller images keep their size.
+func fit(img image.Image, maxSize int) *image.NRGBA {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			width, height = maxSize, max(1, height*maxSize/width)
+		} else {
+			width, height = max(1, width*maxSize/height), maxSize
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if width == b.Dx() && height == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	}
+
+	return dst
+}
+
+// orient turns img upright, as described by an EXIF orientation between 1 and 8.
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+
+	// orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // flip horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotate 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip vertically
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+
+			src := img.PixOffset(x, y)
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], img.Pix[src:src+4])
+		}
+	}
+
+	return dst
+}
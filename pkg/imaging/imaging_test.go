@@ -0,0 +1,218 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.NRGBA{R: 255, A: 255}
+	blue = color.NRGBA{B: 255, A: 255}
+)
+
+// testImage returns a w x h image, blue with a red top-left quarter.
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 && y < h/2 {
+				img.SetNRGBA(x, y, red)
+			} else {
+				img.SetNRGBA(x, y, blue)
+			}
+		}
+	}
+
+	return img
+}
+
+// exifSegment returns an APP1 segment with an orientation, in byte order.
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	return append(segment, payload...)
+}
+
+// jpegWithOrientation encodes img as jpeg, with an EXIF orientation.
+func jpegWithOrientation(t *testing.T, img image.Image, order binary.ByteOrder, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	out := append([]byte{}, b[:2]...)
+	out = append(out, exifSegment(order, orientation)...)
+
+	return append(out, b[2:]...)
+}
+
+func isColor(c color.Color, expected color.NRGBA) bool {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	near := func(a, b uint8) bool { return int(a)-int(b) < 40 && int(b)-int(a) < 40 }
+
+	return near(n.R, expected.R) && near(n.G, expected.G) && near(n.B, expected.B)
+}
+
+func Test_readOrientation(t *testing.T) {
+	img := testImage(8, 8)
+
+	var tests = []struct {
+		name     string
+		data     []byte
+		expected int
+		ok       bool
+	}{
+		{"little-endian", jpegWithOrientation(t, img, binary.LittleEndian, 6), 6, true},
+		{"big-endian", jpegWithOrientation(t, img, binary.BigEndian, 3), 3, true},
+		{"invalid-orientation", jpegWithOrientation(t, img, binary.BigEndian, 9), 0, false},
+		{"no-exif", jpegWithOrientation(t, img, binary.BigEndian, 1)[len(exifSegment(binary.BigEndian, 1)):], 0, false},
+		{"not-jpeg", []byte("\x89PNG\r\n\x1a\n"), 0, false},
+		{"truncated", jpegWithOrientation(t, img, binary.BigEndian, 6)[:12], 0, false},
+	}
+
+	for _, e := range tests {
+		o, err := readOrientation(bytes.NewReader(e.data))
+		if (err == nil) != e.ok || o != e.expected {
+			t.Errorf("%s: expected %d, %v; got %d, %v", e.name, e.expected, e.ok, o, err)
+		}
+	}
+}
+
+func TestNormalize_orientation(t *testing.T) {
+	// stored on its side: 40 wide, 20 high, red in the top-left corner
+	img := testImage(40, 20)
+
+	var tests = []struct {
+		orientation   uint16
+		width, height int
+		redAt         image.Point
+	}{
+		{1, 40, 20, image.Pt(5, 5)},
+		{2, 40, 20, image.Pt(34, 5)},
+		{3, 40, 20, image.Pt(34, 14)},
+		{4, 40, 20, image.Pt(5, 14)},
+		{5, 20, 40, image.Pt(5, 5)},
+		{6, 20, 40, image.Pt(14, 5)},
+		{7, 20, 40, image.Pt(14, 34)},
+		{8, 20, 40, image.Pt(5, 34)},
+	}
+
+	for _, e := range tests {
+		data := jpegWithOrientation(t, img, binary.LittleEndian, e.orientation)
+
+		out, format, err := Normalize(bytes.NewReader(data), 100)
+		if err != nil {
+			t.Fatalf("orientation %d: %s", e.orientation, err)
+		}
+
+		if format != "jpeg" {
+			t.Errorf("orientation %d: expected jpeg; got %s", e.orientation, format)
+		}
+
+		if out.Bounds().Dx() != e.width || out.Bounds().Dy() != e.height {
+			t.Errorf("orientation %d: expected %dx%d; got %v", e.orientation, e.width, e.height, out.Bounds())
+		}
+
+		if !isColor(out.At(e.redAt.X, e.redAt.Y), red) {
+			t.Errorf("orientation %d: expected red at %v; got %v", e.orientation, e.redAt, out.At(e.redAt.X, e.redAt.Y))
+		}
+	}
+}
+
+func TestNormalize_scalesDown(t *testing.T) {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, testImage(400, 100))
+
+	out, format, err := Normalize(bytes.NewReader(buf.Bytes()), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != "png" || out.Bounds() != image.Rect(0, 0, 200, 50) {
+		t.Errorf("expected a 200x50 png; got %s %v", format, out.Bounds())
+	}
+
+	// small images keep their size
+	out, _, _ = Normalize(bytes.NewReader(buf.Bytes()), 1000)
+	if out.Bounds() != image.Rect(0, 0, 400, 100) {
+		t.Errorf("expected 400x100; got %v", out.Bounds())
+	}
+}
+
+func TestNormalize_errors(t *testing.T) {
+	if _, _, err := Normalize(bytes.NewReader([]byte("not an image")), 100); err == nil {
+		t.Error("expected an error for data that is not an image")
+	}
+
+	old := MaxPixels
+	defer func() { MaxPixels = old }()
+	MaxPixels = 100
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, testImage(20, 20))
+
+	if _, _, err := Normalize(bytes.NewReader(buf.Bytes()), 100); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge; got %v", err)
+	}
+}
+
+func TestEncode_stripsMetadata(t *testing.T) {
+	data := jpegWithOrientation(t, testImage(40, 20), binary.BigEndian, 6)
+
+	img, format, err := Normalize(bytes.NewReader(data), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, format); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte("Exif")) {
+		t.Error("encoded image still has EXIF data")
+	}
+
+	if _, err := readOrientation(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("encoded image still has an orientation")
+	}
+
+	if Extension(format) != ".jpg" || Extension("gif") != ".png" {
+		t.Error("wrong extensions")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	thumb := Thumbnail(testImage(200, 100), 50)
+
+	if thumb.Bounds() != image.Rect(0, 0, 50, 50) {
+		t.Fatalf("expected 50x50; got %v", thumb.Bounds())
+	}
+
+	// the center square of the image is cropped, starting at x=50
+	if !isColor(thumb.At(10, 10), red) || !isColor(thumb.At(40, 10), blue) {
+		t.Errorf("thumbnail is not the center of the image")
+	}
+}
@@ -0,0 +1,195 @@
+// Package lockout protects logins against brute force attacks. Failed attempts are
+// counted per account and per client ip, and once there are too many of them the
+// account or ip is locked for a while, twice as long after every further failure.
+package lockout
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned by Check when the account or the ip is locked. Callers
+// should show it to the user as a generic login error.
+var ErrLocked = errors.New("too many failed login attempts")
+
+// Policy describes when something is locked and for how long.
+type Policy struct {
+	// MaxFailures is the number of failed attempts allowed before locking.
+	MaxFailures int
+	// BaseDelay is the length of the first lock, it doubles on every failure after that.
+	BaseDelay time.Duration
+	// MaxDelay caps the length of a lock.
+	MaxDelay time.Duration
+	// Window is how long failures are remembered.
+	Window time.Duration
+}
+
+var (
+	DefaultAccountPolicy = Policy{MaxFailures: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour}
+	DefaultIPPolicy      = Policy{MaxFailures: 20, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+)
+
+// LockDuration returns how long to lock after the given number of failures.
+func (p Policy) LockDuration(failures int) time.Duration {
+	if failures < p.MaxFailures {
+		return 0
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(failures-p.MaxFailures))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+
+	return time.Duration(delay)
+}
+
+// Record is what a store keeps about the failed attempts for one key.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Fail returns the record after one more failure at now. Failures outside the
+// window of the policy are forgotten first.
+func (r Record) Fail(p Policy, now time.Time) Record {
+	if !r.LastFailure.IsZero() && now.Sub(r.LastFailure) > p.Window {
+		r.Failures = 0
+	}
+
+	r.Failures++
+	r.LastFailure = now
+
+	if d := p.LockDuration(r.Failures); d > 0 {
+		r.LockedUntil = now.Add(d)
+	}
+
+	return r
+}
+
+// Store keeps failed attempts by key.
+type Store interface {
+	// Get returns the record for key, or an empty record.
+	Get(key string) (Record, error)
+	// Fail atomically registers a failed attempt for key.
+	Fail(key string, p Policy) (Record, error)
+	// Reset forgets every failed attempt for key.
+	Reset(key string) error
+	// DeleteStale removes records that have not failed since before and are not locked.
+	DeleteStale(before time.Time) error
+}
+
+// Guard checks and tracks login attempts. Both servers use it, so they lock the
+// same way.
+type Guard struct {
+	Store         Store
+	AccountPolicy Policy
+	IPPolicy      Policy
+}
+
+// New returns a guard using the default policies.
+func New(store Store) *Guard {
+	return &Guard{
+		Store:         store,
+		AccountPolicy: DefaultAccountPolicy,
+		IPPolicy:      DefaultIPPolicy,
+	}
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns ErrLocked when either the account or the ip is locked, and how
+// long until the lock ends.
+func (g *Guard) Check(account, ip string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		r, err := g.Store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+
+		if r.LockedUntil.After(now) && r.LockedUntil.Sub(now) > wait {
+			wait = r.LockedUntil.Sub(now)
+		}
+	}
+
+	if wait > 0 {
+		return wait, ErrLocked
+	}
+
+	return 0, nil
+}
+
+// Fail registers a failed login for the account and the ip.
+func (g *Guard) Fail(account, ip string) error {
+	r, err := g.Store.Fail(accountKey(account), g.AccountPolicy)
+	if err != nil {
+		return err
+	}
+
+	if r.Failures == g.AccountPolicy.MaxFailures {
+		log.Printf("locking account %s after %d failed logins", account, r.Failures)
+	}
+
+	r, err = g.Store.Fail(ipKey(ip), g.IPPolicy)
+	if err != nil {
+		return err
+	}
+
+	if r.Failures == g.IPPolicy.MaxFailures {
+		log.Printf("locking ip %s after %d failed logins", ip, r.Failures)
+	}
+
+	return nil
+}
+
+// Succeed forgets the failed attempts of an account after a successful login.
+func (g *Guard) Succeed(account string) error {
+	return g.Store.Reset(accountKey(account))
+}
+
+// Unlock clears the lock and failed attempts of an account, it is used by admins.
+func (g *Guard) Unlock(account string) error {
+	return g.Store.Reset(accountKey(account))
+}
+
+// StartCleanup removes stale records from the store every interval, until the
+// returned stop function is called.
+func (g *Guard) StartCleanup(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	window := g.AccountPolicy.Window
+	if g.IPPolicy.Window > window {
+		window = g.IPPolicy.Window
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := g.Store.DeleteStale(time.Now().Add(-window)); err != nil {
+					log.Println("error cleaning up login attempts:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,103 @@
+package lockout
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicy_LockDuration(t *testing.T) {
+	p := Policy{MaxFailures: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	var tests = []struct {
+		failures int
+		expected time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+
+	for _, e := range tests {
+		if d := p.LockDuration(e.failures); d != e.expected {
+			t.Errorf("%d failures: expected %s; got %s", e.failures, e.expected, d)
+		}
+	}
+}
+
+func TestRecord_Fail_window(t *testing.T) {
+	p := Policy{MaxFailures: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	now := time.Now()
+
+	r := Record{Failures: 2, LastFailure: now.Add(-2 * time.Hour)}
+	r = r.Fail(p, now)
+
+	if r.Failures != 1 || !r.LockedUntil.IsZero() {
+		t.Errorf("old failures should have been forgotten; got %+v", r)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	g := New(NewMemoryStore())
+	g.AccountPolicy = Policy{MaxFailures: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	g.IPPolicy = Policy{MaxFailures: 4, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+	// the account is locked after 2 failures
+	_ = g.Fail("Admin@example.com", "1.1.1.1")
+	if _, err := g.Check("admin@example.com", "1.1.1.1"); err != nil {
+		t.Errorf("locked after one failure: %s", err)
+	}
+
+	_ = g.Fail("admin@example.com", "1.1.1.1")
+	wait, err := g.Check("admin@example.com", "2.2.2.2")
+	if !errors.Is(err, ErrLocked) || wait <= 0 {
+		t.Errorf("expected account to be locked; got %s, %v", wait, err)
+	}
+
+	// an admin can unlock it
+	_ = g.Unlock("admin@example.com")
+	if _, err := g.Check("admin@example.com", "2.2.2.2"); err != nil {
+		t.Errorf("still locked after unlock: %s", err)
+	}
+
+	// the ip is locked after 4 failures, whatever the account
+	_ = g.Fail("a@example.com", "1.1.1.1")
+	_ = g.Fail("b@example.com", "1.1.1.1")
+	if _, err := g.Check("c@example.com", "1.1.1.1"); !errors.Is(err, ErrLocked) {
+		t.Error("expected ip to be locked")
+	}
+
+	if _, err := g.Check("c@example.com", "3.3.3.3"); err != nil {
+		t.Errorf("other ip should not be locked: %s", err)
+	}
+
+	// a successful login resets the account
+	_ = g.Fail("jane@example.com", "4.4.4.4")
+	_ = g.Succeed("jane@example.com")
+	r, _ := g.Store.Get(accountKey("jane@example.com"))
+	if r.Failures != 0 {
+		t.Errorf("expected failures to be reset; got %d", r.Failures)
+	}
+}
+
+func TestMemoryStore_DeleteStale(t *testing.T) {
+	store := NewMemoryStore()
+	store.records["stale"] = Record{Failures: 1, LastFailure: time.Now().Add(-2 * time.Hour)}
+	store.records["locked"] = Record{Failures: 9, LastFailure: time.Now().Add(-2 * time.Hour), LockedUntil: time.Now().Add(time.Hour)}
+	store.records["fresh"] = Record{Failures: 1, LastFailure: time.Now()}
+
+	_ = store.DeleteStale(time.Now().Add(-time.Hour))
+
+	if _, ok := store.records["stale"]; ok {
+		t.Error("stale record was not deleted")
+	}
+
+	if len(store.records) != 2 {
+		t.Errorf("expected 2 records left; got %d", len(store.records))
+	}
+}
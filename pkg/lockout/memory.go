@@ -0,0 +1,58 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that lives in memory, it is only suitable for a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]Record),
+	}
+}
+
+func (s *MemoryStore) Get(key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Fail(key string, p Policy) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.records[key].Fail(p, time.Now())
+	s.records[key] = r
+
+	return r, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteStale(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, r := range s.records {
+		if r.LastFailure.Before(before) && !r.LockedUntil.After(now) {
+			delete(s.records, key)
+		}
+	}
+
+	return nil
+}
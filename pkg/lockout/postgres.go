@@ -0,0 +1,105 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+// PostgresStore is a Store kept in the login_attempts table, shared by every instance.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func (s *PostgresStore) Get(key string) (Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select failures, last_failure, locked_until from login_attempts where key = $1`
+
+	var r Record
+	var lockedUntil sql.NullTime
+	err := s.DB.QueryRowContext(ctx, query, key).Scan(&r.Failures, &r.LastFailure, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{}, nil
+		}
+		return Record{}, err
+	}
+
+	r.LockedUntil = lockedUntil.Time
+
+	return r, nil
+}
+
+// Fail counts the failure in a single upsert, so concurrent failures, the
+// first ones for a key too, are all counted. Failures outside the window of
+// the policy are forgotten first, like Record.Fail does.
+func (s *PostgresStore) Fail(key string, p Policy) (Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	stmt := `insert into login_attempts as a (key, failures, last_failure) values ($1, 1, $2)
+		on conflict (key) do update set
+			failures = case when a.last_failure < $3 then 1 else a.failures + 1 end,
+			last_failure = $2
+		returning failures, last_failure, locked_until`
+
+	r := Record{}
+	var lockedUntil sql.NullTime
+	err := s.DB.QueryRowContext(ctx, stmt, key, now, now.Add(-p.Window)).Scan(&r.Failures, &r.LastFailure, &lockedUntil)
+	if err != nil {
+		return Record{}, err
+	}
+	r.LockedUntil = lockedUntil.Time
+
+	d := p.LockDuration(r.Failures)
+	if d == 0 {
+		return r, nil
+	}
+
+	// a lock is only ever made longer by a concurrent failure
+	stmt = `update login_attempts set locked_until = greatest(locked_until, $2) where key = $1
+		returning locked_until`
+
+	err = s.DB.QueryRowContext(ctx, stmt, key, now.Add(d)).Scan(&r.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		// reset in the meantime, by a successful login or an admin
+		return Record{}, nil
+	} else if err != nil {
+		return Record{}, err
+	}
+
+	return r, nil
+}
+
+func (s *PostgresStore) Reset(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `delete from login_attempts where key = $1`, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) DeleteStale(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from login_attempts where last_failure < $1 and (locked_until is null or locked_until <= $2)`
+
+	_, err := s.DB.ExecContext(ctx, stmt, before, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
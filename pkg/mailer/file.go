@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes every email as an .eml file into Dir, for local development
+// and tests. When Dir is empty, emails are written to the log instead.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu    sync.Mutex
+	count int
+}
+
+// Send writes msg into a new file, or to the log.
+func (m *FileMailer) Send(msg Message) error {
+	now := time.Now()
+	content := msg.format(m.From, now)
+
+	if m.Dir == "" {
+		log.Printf("mail to %s:\n%s", msg.To, content)
+		return nil
+	}
+
+	m.mu.Lock()
+	m.count++
+	name := fmt.Sprintf("%s-%03d.eml", now.UTC().Format("20060102T150405"), m.count)
+	m.mu.Unlock()
+
+	file := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		return err
+	}
+
+	log.Printf("mail to %s saved to %s", msg.To, file)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage_format(t *testing.T) {
+	msg := Message{
+		To:      "jane@example.com",
+		Subject: "Hello\r\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	}
+
+	formatted := string(msg.format("no-reply@example.com", time.Date(2022, 8, 19, 0, 0, 0, 0, time.UTC)))
+
+	for _, expected := range []string{
+		"From: no-reply@example.com\r\n",
+		"To: jane@example.com\r\n",
+		"Subject: HelloBcc: evil@example.com\r\n",
+		"Date: Fri, 19 Aug 2022 00:00:00 +0000\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(formatted, expected) {
+			t.Errorf("expected %q in message; got %q", expected, formatted)
+		}
+	}
+
+	if strings.Contains(formatted, "\r\nBcc:") {
+		t.Error("subject was able to inject a header")
+	}
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	for i := 0; i < 2; i++ {
+		err := m.Send(Message{To: "jane@example.com", Subject: "Reset", Body: "the link"})
+		if err != nil {
+			t.Fatalf("error sending mail: %s", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("expected 2 mails in %s; got %d", dir, len(files))
+	}
+
+	content, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(content), "To: jane@example.com") || !strings.HasSuffix(string(content), "the link") {
+		t.Errorf("mail was not written correctly: %q", content)
+	}
+}
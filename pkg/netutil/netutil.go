@@ -0,0 +1,98 @@
+// Package netutil finds the ip address of the client of a request, which is
+// what lockouts and rate limits are keyed on, also behind reverse proxies.
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the proxies whose X-Forwarded-For is believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma separated list of ip addresses and
+// networks, like 10.0.0.1,192.168.0.0/16.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var networks TrustedProxies
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Trusted reports whether ip is one of the proxies.
+func (p TrustedProxies) Trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range p {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the ip address of the client. It is the address the request
+// came from, X-Forwarded-For is only believed when that is one of the proxies,
+// as anyone else can send any address. The header is read from the right, the
+// first address that is not a trusted proxy is the client.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if ip == "" {
+		return "unknown"
+	}
+
+	if !p.Trusted(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !p.Trusted(hop) {
+			break
+		}
+	}
+
+	return ip
+}
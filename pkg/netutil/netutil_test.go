@@ -0,0 +1,83 @@
+package netutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.1, 172.16.0.0/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		trusted      bool
+		expectedIP   string
+	}{
+		{"remote-addr", "192.0.2.1:1234", nil, true, "192.0.2.1"},
+		{"spoofed", "192.0.2.1:1234", []string{"203.0.113.1"}, true, "192.0.2.1"},
+		{"no-trusted-proxies", "10.0.0.1:1234", []string{"203.0.113.1"}, false, "10.0.0.1"},
+		{"trusted-proxy", "10.0.0.1:1234", []string{"203.0.113.1"}, true, "203.0.113.1"},
+		{"client-prepends", "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.1"}, true, "203.0.113.1"},
+		{"proxy-chain", "10.0.0.1:1234", []string{"203.0.113.1, 172.16.0.5"}, true, "203.0.113.1"},
+		{"several-headers", "10.0.0.1:1234", []string{"198.51.100.1", "203.0.113.1"}, true, "203.0.113.1"},
+		{"garbage", "10.0.0.1:1234", []string{"nonsense"}, true, "10.0.0.1"},
+		{"only-proxies", "10.0.0.1:1234", []string{"172.16.0.5"}, true, "172.16.0.5"},
+		{"no-port", "192.0.2.1", nil, true, "192.0.2.1"},
+		{"empty", "", []string{"203.0.113.1"}, true, "unknown"},
+	}
+
+	for _, e := range tests {
+		var p TrustedProxies
+		if e.trusted {
+			p = proxies
+		}
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		for _, v := range e.forwardedFor {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+
+		if ip := p.ClientIP(req); ip != e.expectedIP {
+			t.Errorf("%s: expected %s; got %s", e.name, e.expectedIP, ip)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	var tests = []struct {
+		name          string
+		list          string
+		expectedCount int
+		expectedError bool
+	}{
+		{"empty", "", 0, false},
+		{"addresses", "10.0.0.1,::1", 2, false},
+		{"networks", "10.0.0.0/8, 192.168.0.0/16,", 2, false},
+		{"invalid-address", "10.0.0", 0, true},
+		{"invalid-network", "10.0.0.0/33", 0, true},
+	}
+
+	for _, e := range tests {
+		networks, err := ParseTrustedProxies(e.list)
+		if e.expectedError {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+		}
+
+		if len(networks) != e.expectedCount {
+			t.Errorf("%s: expected %d networks; got %d", e.name, e.expectedCount, len(networks))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that lives in memory, it is only suitable for a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]Bucket),
+	}
+}
+
+func (s *MemoryStore) Take(key string, rate Rate) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, result := s.buckets[key].Take(rate, time.Now())
+	s.buckets[key] = b
+
+	return result, nil
+}
+
+func (s *MemoryStore) DeleteStale(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.UpdatedAt.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+
+	return nil
+}
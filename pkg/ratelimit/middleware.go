@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc returns the key a request is limited by.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP limits requests by the ip address of the client.
+func KeyByIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// Limiter is a middleware limiting one group of routes.
+type Limiter struct {
+	// Name separates the buckets of different route groups using the same store.
+	Name  string
+	Store Store
+	Rate  Rate
+	Key   KeyFunc
+	// OnLimited writes the response to limited requests, after the headers are
+	// set. By default it writes a plain text 429.
+	OnLimited http.HandlerFunc
+}
+
+// Handler limits the requests to next. It sets the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers on every response, and
+// Retry-After when the request is refused with 429.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := l.Store.Take(l.Name+":"+l.Key(r), l.Rate)
+		if err != nil {
+			// better to let requests through than to fail every one of them
+			log.Println("error checking rate limit:", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", seconds(result.RetryAfter))
+
+			if l.OnLimited != nil {
+				l.OnLimited(w, r)
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// seconds rounds a duration up to whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+// PostgresStore is a Store kept in the rate_limits table, shared by every instance.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func (s *PostgresStore) Take(key string, rate Rate) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// make sure the row exists, and lock it
+	_, err = tx.ExecContext(ctx, `insert into rate_limits (key, tokens, updated_at) values ($1, $2, null)
+		on conflict (key) do nothing`, key, float64(rate.Limit))
+	if err != nil {
+		return Result{}, err
+	}
+
+	var b Bucket
+	var updatedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `select tokens, updated_at from rate_limits where key = $1 for update`, key).
+		Scan(&b.Tokens, &updatedAt)
+	if err != nil {
+		return Result{}, err
+	}
+	b.UpdatedAt = updatedAt.Time
+
+	b, result := b.Take(rate, time.Now())
+
+	_, err = tx.ExecContext(ctx, `update rate_limits set tokens = $1, updated_at = $2 where key = $3`,
+		b.Tokens, b.UpdatedAt, key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+func (s *PostgresStore) DeleteStale(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `delete from rate_limits where updated_at < $1 or updated_at is null`, before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
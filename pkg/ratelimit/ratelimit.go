@@ -0,0 +1,102 @@
+// Package ratelimit limits how often a client can call a route, using token
+// buckets. Every key (a client ip, a user id, ...) gets a bucket holding up to
+// Rate.Limit tokens that refills evenly over Rate.Period; every request takes
+// one token, and requests are refused while the bucket is empty.
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// Rate is the number of requests allowed per period.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// PerMinute returns a rate of n requests a minute.
+func PerMinute(n int) Rate {
+	return Rate{Limit: n, Period: time.Minute}
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, it is zero when allowed.
+	RetryAfter time.Duration
+}
+
+// Bucket is the state a store keeps per key.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Take refills the bucket for the time passed since it was last updated, and
+// takes one token from it if there is one. A zero bucket is a full one.
+func (b Bucket) Take(rate Rate, now time.Time) (Bucket, Result) {
+	limit := float64(rate.Limit)
+	perToken := rate.Period / time.Duration(rate.Limit)
+
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = limit
+	} else {
+		elapsed := now.Sub(b.UpdatedAt)
+		b.Tokens = math.Min(limit, b.Tokens+float64(elapsed)/float64(perToken))
+	}
+	b.UpdatedAt = now
+
+	result := Result{Limit: rate.Limit}
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.Tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(b.Tokens)
+	result.Reset = time.Duration((limit - b.Tokens) * float64(perToken))
+
+	return b, result
+}
+
+// Store keeps a bucket per key.
+type Store interface {
+	// Take atomically takes a token from the bucket of key.
+	Take(key string, rate Rate) (Result, error)
+	// DeleteStale removes buckets that were not used since before.
+	DeleteStale(before time.Time) error
+}
+
+// StartCleanup removes buckets that were not used for maxAge from the store
+// every interval, until the returned stop function is called. maxAge has to be
+// longer than the longest period used with the store, as removing a bucket fills it.
+func StartCleanup(store Store, interval, maxAge time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := store.DeleteStale(time.Now().Add(-maxAge)); err != nil {
+					log.Println("error cleaning up rate limits:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBucket_Take(t *testing.T) {
+	rate := Rate{Limit: 3, Period: 3 * time.Second}
+	now := time.Now()
+
+	var b Bucket
+	var result Result
+
+	for i := 0; i < 3; i++ {
+		b, result = b.Take(rate, now)
+		if !result.Allowed {
+			t.Fatalf("request %d should have been allowed", i+1)
+		}
+	}
+
+	if result.Remaining != 0 || result.Reset != 3*time.Second {
+		t.Errorf("expected empty bucket resetting in 3s; got %+v", result)
+	}
+
+	b, result = b.Take(rate, now)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("expected request to be refused for 1s; got %+v", result)
+	}
+
+	// one token is back after a second
+	b, result = b.Take(rate, now.Add(time.Second))
+	if !result.Allowed {
+		t.Error("expected request to be allowed after a token refilled")
+	}
+
+	// the bucket never holds more than the limit
+	_, result = b.Take(rate, now.Add(time.Hour))
+	if result.Remaining != 2 {
+		t.Errorf("expected 2 remaining after a long pause; got %d", result.Remaining)
+	}
+}
+
+func TestLimiter_Handler(t *testing.T) {
+	limiter := &Limiter{
+		Name:  "test",
+		Store: NewMemoryStore(),
+		Rate:  PerMinute(2),
+		Key:   KeyByIP,
+	}
+
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		name         string
+		remoteAddr   string
+		expectedCode int
+		remaining    string
+	}{
+		{"first", "1.1.1.1:1234", http.StatusOK, "1"},
+		{"second", "1.1.1.1:1234", http.StatusOK, "0"},
+		{"limited", "1.1.1.1:1234", http.StatusTooManyRequests, "0"},
+		{"other-ip", "2.2.2.2:1234", http.StatusOK, "1"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d; got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != e.remaining {
+			t.Errorf("%s: wrong rate limit headers %v", e.name, rr.Header())
+		}
+
+		if e.expectedCode == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "30" {
+			t.Errorf("%s: expected Retry-After 30; got %q", e.name, rr.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestMemoryStore_DeleteStale(t *testing.T) {
+	store := NewMemoryStore()
+	_, _ = store.Take("a", PerMinute(1))
+
+	_ = store.DeleteStale(time.Now().Add(time.Second))
+
+	if len(store.buckets) != 0 {
+		t.Error("expected stale bucket to be deleted")
+	}
+}
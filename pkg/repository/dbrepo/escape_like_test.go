@@ -0,0 +1,22 @@
+package dbrepo
+
+import "testing"
+
+func Test_escapeLike(t *testing.T) {
+	var tests = []struct {
+		query    string
+		expected string
+	}{
+		{"anna", "anna"},
+		{"100%", `100\%`},
+		{"first_name", `first\_name`},
+		{`back\slash`, `back\\slash`},
+		{`%_\`, `\%\_\\`},
+	}
+
+	for _, e := range tests {
+		if got := escapeLike(e.query); got != e.expected {
+			t.Errorf("escapeLike(%q): expected %q; got %q", e.query, e.expected, got)
+		}
+	}
+}
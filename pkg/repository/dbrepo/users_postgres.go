@@ -3,9 +3,13 @@ package dbrepo
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 	"time"
+	"unicode"
 	"webapp/pkg/data"
+	"webapp/pkg/repository"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -25,7 +29,7 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, is_admin, created_at, updated_at
+	query := `select id, email, first_name, last_name, password, is_admin, created_at, updated_at, email_verified_at
 	from users order by last_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
@@ -38,6 +42,7 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 
 	for rows.Next() {
 		var user data.User
+		var verifiedAt sql.NullTime
 		err := rows.Scan(
 			&user.ID,
 			&user.Email,
@@ -47,11 +52,13 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 			&user.IsAdmin,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&verifiedAt,
 		)
 		if err != nil {
 			log.Println("Error scanning", err)
 			return nil, err
 		}
+		user.EmailVerifiedAt = verifiedAt.Time
 
 		users = append(users, &user)
 	}
@@ -59,6 +66,208 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	return users, nil
 }
 
+// userSortColumns maps the sort fields of repository.ListOptions to columns
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"email":      "email",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"created_at": "created_at",
+}
+
+// ListUsers returns one page of users, filtered and sorted as described by opts
+func (m *PostgresDBRepo) ListUsers(opts repository.ListOptions) (*repository.UserPage, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// filters
+	if opts.IsAdmin != nil {
+		where = append(where, "is_admin = "+arg(*opts.IsAdmin))
+	}
+
+	if !opts.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(opts.CreatedAfter))
+	}
+
+	if !opts.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(opts.CreatedBefore))
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = "where " + strings.Join(where, " and ")
+	}
+
+	// count every row matching the filters, ignoring the cursor
+	page := repository.UserPage{Limit: opts.Limit}
+	err = m.DB.QueryRowContext(ctx, "select count(*) from users "+filter, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	column := userSortColumns[opts.Sort]
+	direction, comparison := "asc", ">"
+	if opts.Desc {
+		direction, comparison = "desc", "<"
+	}
+
+	// continue after the last row of the previous page
+	if opts.Cursor != "" {
+		value, id, err := repository.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+
+		if column == "id" {
+			where = append(where, fmt.Sprintf("id %s %s", comparison, arg(id)))
+		} else {
+			where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(value), arg(id)))
+		}
+
+		filter = "where " + strings.Join(where, " and ")
+	}
+
+	// fetch one extra row, to know if there is a next page
+	query := fmt.Sprintf(`select id, email, first_name, last_name, password, is_admin, created_at, updated_at, email_verified_at
+	from users %s order by %s %s, id %s limit %s`, filter, column, direction, direction, arg(opts.Limit+1))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user data.User
+		var verifiedAt sql.NullTime
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.IsAdmin,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&verifiedAt,
+		)
+		if err != nil {
+			log.Println("Error scanning", err)
+			return nil, err
+		}
+		user.EmailVerifiedAt = verifiedAt.Time
+
+		page.Users = append(page.Users, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		page.NextCursor = repository.EncodeCursor(page.Users[opts.Limit-1], opts.Sort)
+	}
+
+	return &page, nil
+}
+
+// likeEscaper escapes the wildcards of like patterns, and the escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s match itself in a like pattern, so % and _ typed in a
+// search are not wildcards.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// userSearchDocument is the text users are searched by. It has to match the
+// expression of the users_search_* indexes, or they will not be used.
+const userSearchDocument = `(coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || coalesce(email, ''))`
+
+// SearchUsers finds users by (partial) name or email, best matches first. Whole
+// words and word prefixes are found with full text search, typos and fragments
+// with trigram similarity.
+func (m *PostgresDBRepo) SearchUsers(query string, limit int) ([]*data.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if limit <= 0 || limit > repository.MaxListLimit {
+		limit = repository.DefaultListLimit
+	}
+
+	// match every word of the query as a prefix
+	var terms []string
+	for _, word := range strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		terms = append(terms, word+":*")
+	}
+
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	stmt := fmt.Sprintf(`
+		select
+			id, email, first_name, last_name, password, is_admin, created_at, updated_at, email_verified_at
+		from
+			users
+		where
+			to_tsvector('simple', %[1]s) @@ to_tsquery('simple', $1)
+			or $2 <%% %[1]s
+			or %[1]s ilike '%%' || $4 || '%%' escape '\'
+		order by
+			ts_rank(to_tsvector('simple', %[1]s), to_tsquery('simple', $1)) + word_similarity($2, %[1]s) desc,
+			id
+		limit $3`, userSearchDocument)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, strings.Join(terms, " & "), strings.TrimSpace(query), limit, escapeLike(strings.TrimSpace(query)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*data.User
+
+	for rows.Next() {
+		var user data.User
+		var verifiedAt sql.NullTime
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.IsAdmin,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&verifiedAt,
+		)
+		if err != nil {
+			log.Println("Error scanning", err)
+			return nil, err
+		}
+		user.EmailVerifiedAt = verifiedAt.Time
+
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
 // GetUser returns one user by id
 func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
@@ -66,8 +275,11 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 
 	query := `
 		select 
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at,
-			coalesce(ui.file_name, '')
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at, u.email_verified_at,
+			u.locale,
+			coalesce(ui.id, 0),
+			coalesce(ui.file_name, ''),
+			coalesce(ui.original_file_name, '')
 		from 
 			users u
 			left join user_images ui on (ui.user_id = u.id)
@@ -75,6 +287,7 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 		    u.id = $1`
 
 	var user data.User
+	var verifiedAt sql.NullTime
 	row := m.DB.QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
@@ -86,13 +299,27 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 		&user.IsAdmin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&verifiedAt,
+		&user.Locale,
+		&user.ProfilePic.ID,
 		&user.ProfilePic.FileName,
+		&user.ProfilePic.OriginalFileName,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	user.EmailVerifiedAt = verifiedAt.Time
+
+	if user.ProfilePic.ID != 0 {
+		user.ProfilePic.UserID = user.ID
+		user.ProfilePic.Variants, err = m.imageVariants(ctx, user.ProfilePic.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
@@ -103,8 +330,11 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 
 	query := `
 		select 
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at,
-			coalesce(ui.file_name, '')
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at, u.email_verified_at,
+			u.locale,
+			coalesce(ui.id, 0),
+			coalesce(ui.file_name, ''),
+			coalesce(ui.original_file_name, '')
 		from 
 			users u
 			left join user_images ui on (ui.user_id = u.id)
@@ -112,6 +342,7 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		    u.email = $1`
 
 	var user data.User
+	var verifiedAt sql.NullTime
 	row := m.DB.QueryRowContext(ctx, query, email)
 
 	err := row.Scan(
@@ -123,17 +354,32 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		&user.IsAdmin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&verifiedAt,
+		&user.Locale,
+		&user.ProfilePic.ID,
 		&user.ProfilePic.FileName,
+		&user.ProfilePic.OriginalFileName,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	user.EmailVerifiedAt = verifiedAt.Time
+
+	if user.ProfilePic.ID != 0 {
+		user.ProfilePic.UserID = user.ID
+		user.ProfilePic.Variants, err = m.imageVariants(ctx, user.ProfilePic.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
-// UpdateUser updates one user in the database
+// UpdateUser updates one user in the database. Changing the email address
+// makes it unverified again.
 func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -143,8 +389,10 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 		first_name = $2,
 		last_name = $3,
 		is_admin = $4,
-		updated_at = $5
-		where id = $6
+		locale = $5,
+		updated_at = $6,
+		email_verified_at = case when email = $1 then email_verified_at end
+		where id = $7
 	`
 
 	_, err := m.DB.ExecContext(ctx, stmt,
@@ -152,6 +400,7 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 		u.FirstName,
 		u.LastName,
 		u.IsAdmin,
+		u.Locale,
 		time.Now(),
 		u.ID,
 	)
@@ -189,8 +438,8 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 	}
 
 	var newID int
-	stmt := `insert into users (email, first_name, last_name, password, is_admin, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	stmt := `insert into users (email, first_name, last_name, password, is_admin, locale, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
 
 	err = m.DB.QueryRowContext(ctx, stmt,
 		user.Email,
@@ -198,6 +447,7 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 		user.LastName,
 		hashedPassword,
 		user.IsAdmin,
+		user.Locale,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -209,7 +459,30 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 	return newID, nil
 }
 
-// ResetPassword is the method we will use to change a user's password.
+// VerifyUserEmail marks the email address of a user as verified. It returns
+// false if the user no longer has that email address.
+func (m *PostgresDBRepo) VerifyUserEmail(id int, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set email_verified_at = coalesce(email_verified_at, $1)
+		where id = $2 and email = $3`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), id, email)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// ResetPassword is the method we will use to change a user's password. The
+// password reset links of the user stop working with the old password.
 func (m *PostgresDBRepo) ResetPassword(id int, password string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -219,34 +492,225 @@ func (m *PostgresDBRepo) ResetPassword(id int, password string) error {
 		return err
 	}
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	stmt := `update users set password = $1 where id = $2`
-	_, err = m.DB.ExecContext(ctx, stmt, hashedPassword, id)
+	_, err = tx.ExecContext(ctx, stmt, hashedPassword, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	stmt = `delete from password_resets where user_id = $1`
+	_, err = tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// InsertUserImage inserts a user profile image into the database.
+// InsertUserImage inserts a user profile image, and its variants, into the
+// database. It replaces the previous image of the user.
 func (m *PostgresDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	stmt := `DELETE from user_images where user_id = $1`
-	_, err := m.DB.ExecContext(ctx, stmt, i.UserID)
+	_, err = tx.ExecContext(ctx, stmt, i.UserID)
 	if err != nil {
 		return 0, err
 	}
 
 	var newID int
-	stmt = `insert into user_images (user_id, file_name, created_at, updated_at)
-		values ($1, $2, $3, $4) returning id`
+	stmt = `insert into user_images (user_id, file_name, original_file_name, created_at, updated_at)
+		values ($1, $2, $3, $4, $5) returning id`
 
-	err = m.DB.QueryRowContext(ctx, stmt,
+	err = tx.QueryRowContext(ctx, stmt,
 		i.UserID,
 		i.FileName,
+		i.OriginalFileName,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `insert into user_image_variants (user_image_id, name, file_name, width, height, created_at)
+		values ($1, $2, $3, $4, $5, $6)`
+
+	for _, v := range i.Variants {
+		_, err = tx.ExecContext(ctx, stmt, newID, v.Name, v.FileName, v.Width, v.Height, time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return newID, tx.Commit()
+}
+
+// imageVariants returns the variants of the user image with imageID.
+func (m *PostgresDBRepo) imageVariants(ctx context.Context, imageID int) ([]data.ImageVariant, error) {
+	query := `select id, user_image_id, name, file_name, width, height, created_at
+		from user_image_variants where user_image_id = $1 order by width`
+
+	rows, err := m.DB.QueryContext(ctx, query, imageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []data.ImageVariant
+	for rows.Next() {
+		var v data.ImageVariant
+		err := rows.Scan(&v.ID, &v.UserImageID, &v.Name, &v.FileName, &v.Width, &v.Height, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+
+	return variants, rows.Err()
+}
+
+// InsertRefreshToken stores a newly issued refresh token, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertRefreshToken(t data.RefreshToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into refresh_tokens (user_id, token_hash, family_id, expires_at, created_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		t.UserID,
+		t.TokenHash,
+		t.FamilyID,
+		t.ExpiresAt,
 		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetRefreshToken returns one refresh token by the hash of the signed token
+func (m *PostgresDBRepo) GetRefreshToken(tokenHash string) (*data.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select
+			id, user_id, token_hash, family_id, expires_at, used_at, revoked_at, created_at
+		from
+			refresh_tokens
+		where
+			token_hash = $1`
+
+	var t data.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	row := m.DB.QueryRowContext(ctx, query, tokenHash)
+
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.TokenHash,
+		&t.FamilyID,
+		&t.ExpiresAt,
+		&usedAt,
+		&revokedAt,
+		&t.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.UsedAt = usedAt.Time
+	t.RevokedAt = revokedAt.Time
+
+	return &t, nil
+}
+
+// UseRefreshToken marks a refresh token as used. It returns false if the token
+// was already used or revoked, which means it is being replayed.
+func (m *PostgresDBRepo) UseRefreshToken(id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set used_at = $1
+		where id = $2 and used_at is null and revoked_at is null`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token that belongs to a token family
+func (m *PostgresDBRepo) RevokeRefreshTokenFamily(familyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where family_id = $2 and revoked_at is null`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), familyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of a user, in every token family
+func (m *PostgresDBRepo) RevokeUserRefreshTokens(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertPasswordReset stores a newly issued password reset token, and returns the ID of the newly inserted row
+func (m *PostgresDBRepo) InsertPasswordReset(r data.PasswordReset) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into password_resets (user_id, token_hash, expires_at, created_at)
+		values ($1, $2, $3, $4) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		r.UserID,
+		r.TokenHash,
+		r.ExpiresAt,
 		time.Now(),
 	).Scan(&newID)
 
@@ -256,3 +720,60 @@ func (m *PostgresDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 
 	return newID, nil
 }
+
+// GetPasswordReset returns one password reset by the hash of its token
+func (m *PostgresDBRepo) GetPasswordReset(tokenHash string) (*data.PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select
+			id, user_id, token_hash, expires_at, used_at, created_at
+		from
+			password_resets
+		where
+			token_hash = $1`
+
+	var r data.PasswordReset
+	var usedAt sql.NullTime
+	row := m.DB.QueryRowContext(ctx, query, tokenHash)
+
+	err := row.Scan(
+		&r.ID,
+		&r.UserID,
+		&r.TokenHash,
+		&r.ExpiresAt,
+		&usedAt,
+		&r.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.UsedAt = usedAt.Time
+
+	return &r, nil
+}
+
+// UsePasswordReset marks a password reset as used. It returns false if the
+// reset was already used or has expired.
+func (m *PostgresDBRepo) UsePasswordReset(id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update password_resets set used_at = $1
+		where id = $2 and used_at is null and expires_at > $1`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
@@ -218,6 +218,7 @@ func TestPostgresDBRepo_UpdateUser(t *testing.T) {
 
 	user.FirstName = "Jane"
 	user.Email = "Jane@gmail.com"
+	user.Locale = "de"
 
 	err := testRepo.UpdateUser(*user)
 	if err != nil {
@@ -228,6 +229,10 @@ func TestPostgresDBRepo_UpdateUser(t *testing.T) {
 	if user.FirstName != "Jane" || user.Email != "Jane@gmail.com" {
 		t.Errorf("expected updated record to have first_name Jane and Email Jane@gmail.com but got %s and %s", user.FirstName, user.Email)
 	}
+
+	if user.Locale != "de" {
+		t.Errorf("expected locale de but got %q", user.Locale)
+	}
 }
 
 func TestPostgresDBRepo_DeleteUser(t *testing.T) {
@@ -259,11 +264,58 @@ func TestPostgresDBRepo_ResetPassword(t *testing.T) {
 	}
 }
 
+func TestPostgresDBRepo_VerifyUserEmail(t *testing.T) {
+	user, _ := testRepo.GetUser(1)
+	if user.EmailVerified() {
+		t.Fatal("new user should not have a verified email address")
+	}
+
+	verified, err := testRepo.VerifyUserEmail(1, "old@gmail.com")
+	if err != nil || verified {
+		t.Errorf("verified an email address the user does not have; got %v, %v", verified, err)
+	}
+
+	verified, err = testRepo.VerifyUserEmail(1, user.Email)
+	if err != nil || !verified {
+		t.Errorf("expected email address to be verified; got %v, %v", verified, err)
+	}
+
+	user, _ = testRepo.GetUser(1)
+	if !user.EmailVerified() {
+		t.Error("email address is not verified after verifying it")
+	}
+
+	// changing the name keeps the address verified, changing the address does not
+	lastName := user.LastName
+	user.LastName = "Verified"
+	_ = testRepo.UpdateUser(*user)
+	user, _ = testRepo.GetUser(1)
+	if !user.EmailVerified() {
+		t.Error("email address lost its verification when updating the name")
+	}
+
+	email := user.Email
+	user.Email = "changed@gmail.com"
+	_ = testRepo.UpdateUser(*user)
+	user, _ = testRepo.GetUser(1)
+	if user.EmailVerified() {
+		t.Error("changed email address is still verified")
+	}
+
+	user.Email, user.LastName = email, lastName
+	_ = testRepo.UpdateUser(*user)
+}
+
 func TestPostgresDBRepo_InsertUserImage(t *testing.T) {
 	var image data.UserImage
 
 	image.UserID = 1
 	image.FileName = "test.png"
+	image.OriginalFileName = "holiday.png"
+	image.Variants = []data.ImageVariant{
+		{Name: "small", FileName: "test-64.png", Width: 64, Height: 64},
+		{Name: "large", FileName: "test-256.png", Width: 256, Height: 256},
+	}
 	image.CreatedAt = time.Now()
 	image.UpdatedAt = time.Now()
 
@@ -276,9 +328,236 @@ func TestPostgresDBRepo_InsertUserImage(t *testing.T) {
 		t.Error("got wrong id for image; should be one but got ", newID)
 	}
 
+	user, err := testRepo.GetUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ProfilePic.OriginalFileName != "holiday.png" || len(user.ProfilePic.Variants) != 2 {
+		t.Errorf("got wrong profile pic back: %+v", user.ProfilePic)
+	}
+
+	if user.ProfilePic.Variant("large") != "test-256.png" || user.ProfilePic.Variant("huge") != "test.png" {
+		t.Errorf("got wrong variants back: %+v", user.ProfilePic.Variants)
+	}
+
 	image.UserID = 100
 	_, err = testRepo.InsertUserImage(image)
 	if err == nil {
 		t.Error("inserted a user image with none-existing user_id")
 	}
 }
+
+func TestPostgresDBRepo_RefreshTokens(t *testing.T) {
+	token := data.RefreshToken{
+		UserID:    1,
+		TokenHash: "hash-1",
+		FamilyID:  "family-1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	id, err := testRepo.InsertRefreshToken(token)
+	if err != nil {
+		t.Fatalf("inserting refresh token failed: %s", err)
+	}
+
+	stored, err := testRepo.GetRefreshToken("hash-1")
+	if err != nil {
+		t.Fatalf("error getting refresh token: %s", err)
+	}
+
+	if stored.ID != id || stored.FamilyID != "family-1" {
+		t.Errorf("got wrong refresh token back: %+v", stored)
+	}
+
+	used, err := testRepo.UseRefreshToken(id)
+	if err != nil || !used {
+		t.Errorf("expected first use of refresh token to succeed; got %v, %v", used, err)
+	}
+
+	used, err = testRepo.UseRefreshToken(id)
+	if err != nil || used {
+		t.Errorf("expected second use of refresh token to fail; got %v, %v", used, err)
+	}
+
+	token.TokenHash = "hash-2"
+	id, _ = testRepo.InsertRefreshToken(token)
+
+	err = testRepo.RevokeRefreshTokenFamily("family-1")
+	if err != nil {
+		t.Errorf("error revoking refresh token family: %s", err)
+	}
+
+	stored, _ = testRepo.GetRefreshToken("hash-2")
+	if stored.RevokedAt.IsZero() {
+		t.Error("refresh token should have been revoked with its family")
+	}
+
+	used, _ = testRepo.UseRefreshToken(id)
+	if used {
+		t.Error("was able to use a revoked refresh token")
+	}
+
+	// a new family of the same user, as after logging in again
+	token.TokenHash = "hash-3"
+	token.FamilyID = "family-2"
+	_, _ = testRepo.InsertRefreshToken(token)
+
+	err = testRepo.RevokeUserRefreshTokens(token.UserID)
+	if err != nil {
+		t.Errorf("error revoking refresh tokens of user: %s", err)
+	}
+
+	stored, _ = testRepo.GetRefreshToken("hash-3")
+	if stored.RevokedAt.IsZero() {
+		t.Error("refresh token should have been revoked with the tokens of its user")
+	}
+}
+
+func TestPostgresDBRepo_PasswordResets(t *testing.T) {
+	reset := data.PasswordReset{
+		UserID:    1,
+		TokenHash: "reset-hash-1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	id, err := testRepo.InsertPasswordReset(reset)
+	if err != nil {
+		t.Fatalf("inserting password reset failed: %s", err)
+	}
+
+	stored, err := testRepo.GetPasswordReset("reset-hash-1")
+	if err != nil {
+		t.Fatalf("error getting password reset: %s", err)
+	}
+
+	if stored.ID != id || stored.UserID != 1 || !stored.UsedAt.IsZero() {
+		t.Errorf("got wrong password reset back: %+v", stored)
+	}
+
+	used, err := testRepo.UsePasswordReset(id)
+	if err != nil || !used {
+		t.Errorf("expected first use of password reset to succeed; got %v, %v", used, err)
+	}
+
+	used, err = testRepo.UsePasswordReset(id)
+	if err != nil || used {
+		t.Errorf("expected second use of password reset to fail; got %v, %v", used, err)
+	}
+
+	reset.TokenHash = "reset-hash-2"
+	reset.ExpiresAt = time.Now().Add(-time.Minute)
+	id, _ = testRepo.InsertPasswordReset(reset)
+
+	used, _ = testRepo.UsePasswordReset(id)
+	if used {
+		t.Error("was able to use an expired password reset")
+	}
+
+	// changing the password deletes all the links of the user
+	reset.TokenHash = "reset-hash-3"
+	reset.ExpiresAt = time.Now().Add(time.Hour)
+	_, _ = testRepo.InsertPasswordReset(reset)
+
+	if err := testRepo.ResetPassword(1, "newpass"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testRepo.GetPasswordReset("reset-hash-3"); err != sql.ErrNoRows {
+		t.Errorf("expected the password reset to be deleted; got %v", err)
+	}
+}
+
+func TestPostgresDBRepo_ListUsers(t *testing.T) {
+	for _, name := range []string{"Anna", "Bert", "Carl"} {
+		_, _ = testRepo.InsertUser(data.User{
+			FirstName: name,
+			LastName:  name,
+			Email:     name + "@example.com",
+			Password:  "test",
+			IsAdmin:   0,
+		})
+	}
+
+	var seen []int
+	opts := repository.ListOptions{Limit: 2, Sort: "last_name"}
+
+	for {
+		page, err := testRepo.ListUsers(opts)
+		if err != nil {
+			t.Fatalf("error listing users: %s", err)
+		}
+
+		if page.Total != 4 {
+			t.Errorf("expected a total of 4 users; got %d", page.Total)
+		}
+
+		if page.Limit != 2 {
+			t.Errorf("expected a limit of 2; got %d", page.Limit)
+		}
+
+		for _, u := range page.Users {
+			seen = append(seen, u.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	if len(seen) != 4 {
+		t.Errorf("expected to page through 4 users; got %d", len(seen))
+	}
+
+	admin := 1
+	page, err := testRepo.ListUsers(repository.ListOptions{IsAdmin: &admin, Sort: "created_at", Desc: true})
+	if err != nil {
+		t.Fatalf("error listing admins: %s", err)
+	}
+
+	if page.Total != 1 || len(page.Users) != 1 {
+		t.Errorf("expected 1 admin; got %d", page.Total)
+	}
+
+	_, err = testRepo.ListUsers(repository.ListOptions{Sort: "password"})
+	if err == nil {
+		t.Error("expected an error sorting by a field that is not allowed")
+	}
+}
+
+func TestPostgresDBRepo_SearchUsers(t *testing.T) {
+	var tests = []struct {
+		name          string
+		query         string
+		expectedFirst string
+	}{
+		{"full-name", "Bert", "Bert"},
+		{"prefix", "Car", "Carl"},
+		{"email", "anna@example", "Anna"},
+		{"typo", "Mohamad", "Mohammad"},
+	}
+
+	for _, e := range tests {
+		users, err := testRepo.SearchUsers(e.query, 10)
+		if err != nil {
+			t.Errorf("%s: error searching users: %s", e.name, err)
+			continue
+		}
+
+		if len(users) == 0 || users[0].FirstName != e.expectedFirst {
+			t.Errorf("%s: expected %s to be the best match", e.name, e.expectedFirst)
+		}
+	}
+
+	users, _ := testRepo.SearchUsers("zzzz", 10)
+	if len(users) != 0 {
+		t.Errorf("expected no users to match; got %d", len(users))
+	}
+
+	// as a pattern, _o_a_m_ would match Mohammad
+	users, _ = testRepo.SearchUsers("_o_a_m_", 10)
+	if len(users) != 0 {
+		t.Errorf("expected wildcards to be matched literally; got %d users", len(users))
+	}
+}
@@ -2,50 +2,152 @@ package dbrepo
 
 import (
 	"database/sql"
-	"errors"
+	"strings"
+	"sync"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/repository"
 )
 
-type TestDBRepo struct{}
+type TestDBRepo struct {
+	mu             sync.Mutex
+	refreshTokens  []*data.RefreshToken
+	passwordResets []*data.PasswordReset
+	// lastResetID numbers the password resets, which are deleted on resets
+	lastResetID int
+	// images are the profile pictures, by user id
+	images map[int]data.UserImage
+}
 
 func (m *TestDBRepo) Connection() *sql.DB {
 	return nil
 }
 
+// testUsers returns the users the test repository knows about. All of them have
+// the password "secret", only the email address of John Smith is not verified.
+func testUsers() []*data.User {
+	created := time.Date(2022, 8, 19, 0, 0, 0, 0, time.UTC)
+	password := "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK"
+
+	return []*data.User{
+		{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", Password: password, IsAdmin: 1, EmailVerifiedAt: created, CreatedAt: created, UpdatedAt: created},
+		{ID: 2, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Password: password, IsAdmin: 0, EmailVerifiedAt: created, CreatedAt: created.AddDate(0, 1, 0), UpdatedAt: created},
+		{ID: 3, FirstName: "John", LastName: "Smith", Email: "john@example.com", Password: password, IsAdmin: 0, CreatedAt: created.AddDate(0, 2, 0), UpdatedAt: created},
+	}
+}
+
 // AllUsers returns all users as a slice of *data.User
 func (m *TestDBRepo) AllUsers() ([]*data.User, error) {
+	return testUsers(), nil
+}
+
+// ListUsers returns one page of users, filtered and sorted as described by opts
+func (m *TestDBRepo) ListUsers(opts repository.ListOptions) (*repository.UserPage, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
 	var users []*data.User
+	for _, u := range testUsers() {
+		if opts.IsAdmin != nil && u.IsAdmin != *opts.IsAdmin {
+			continue
+		}
+		if !opts.CreatedAfter.IsZero() && u.CreatedAt.Before(opts.CreatedAfter) {
+			continue
+		}
+		if !opts.CreatedBefore.IsZero() && !u.CreatedAt.Before(opts.CreatedBefore) {
+			continue
+		}
+		users = append(users, u)
+	}
+
+	page := repository.UserPage{Total: len(users), Limit: opts.Limit}
+
+	// the fixtures are ordered by id, which is all the test repository supports
+	if opts.Desc {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	if opts.Cursor != "" {
+		_, id, err := repository.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, u := range users {
+			if u.ID == id {
+				users = users[i+1:]
+				break
+			}
+		}
+	}
+
+	if len(users) > opts.Limit {
+		page.NextCursor = repository.EncodeCursor(users[opts.Limit-1], opts.Sort)
+		users = users[:opts.Limit]
+	}
+	page.Users = users
+
+	return &page, nil
+}
+
+// SearchUsers finds users whose name or email contains the query, users where
+// it is a prefix come first
+func (m *TestDBRepo) SearchUsers(query string, limit int) ([]*data.User, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, nil
+	}
+
+	var prefix, contains []*data.User
+	for _, u := range testUsers() {
+		document := strings.ToLower(u.FirstName + " " + u.LastName + " " + u.Email)
+
+		switch {
+		case strings.HasPrefix(strings.ToLower(u.FirstName), query),
+			strings.HasPrefix(strings.ToLower(u.LastName), query),
+			strings.HasPrefix(strings.ToLower(u.Email), query):
+			prefix = append(prefix, u)
+		case strings.Contains(document, query):
+			contains = append(contains, u)
+		}
+	}
+
+	users := append(prefix, contains...)
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+	}
 
 	return users, nil
 }
 
 // GetUser returns one user by id
 func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
-	var user = data.User{
-		ID: 1,
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range testUsers() {
+		if u.ID == id {
+			u.ProfilePic = m.images[id]
+			return u, nil
+		}
 	}
 
-	return &user, nil
+	return nil, sql.ErrNoRows
 }
 
 // GetUserByEmail returns one user by email address
 func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
-	if email == "admin@example.com" {
-		user := data.User{
-			ID:        1,
-			FirstName: "Admin",
-			LastName:  "User",
-			Password:  "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
-			IsAdmin:   1,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+	for _, u := range testUsers() {
+		if u.Email == email {
+			return u, nil
 		}
-
-		return &user, nil
 	}
 
-	return nil, errors.New("not found")
+	return nil, sql.ErrNoRows
 }
 
 // UpdateUser updates one user in the database
@@ -65,14 +167,170 @@ func (m *TestDBRepo) InsertUser(user data.User) (int, error) {
 	return 2, nil
 }
 
+// VerifyUserEmail marks the email address of a user as verified. It returns
+// false if the user no longer has that email address.
+func (m *TestDBRepo) VerifyUserEmail(id int, email string) (bool, error) {
+	for _, u := range testUsers() {
+		if u.ID == id {
+			return u.Email == email, nil
+		}
+	}
+
+	return false, nil
+}
+
 // ResetPassword is the method we will use to change a user's password.
 func (m *TestDBRepo) ResetPassword(id int, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var kept []*data.PasswordReset
+	for _, r := range m.passwordResets {
+		if r.UserID != id {
+			kept = append(kept, r)
+		}
+	}
+	m.passwordResets = kept
 
 	return nil
 }
 
-// InsertUserImage inserts a user profile image into the database.
+// InsertUserImage inserts a user profile image into the database. It replaces
+// the previous image of the user.
 func (m *TestDBRepo) InsertUserImage(i data.UserImage) (int, error) {
+	if _, err := m.GetUser(i.UserID); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.images == nil {
+		m.images = map[int]data.UserImage{}
+	}
+	i.ID = m.images[i.UserID].ID + 1
+	m.images[i.UserID] = i
+
+	return i.ID, nil
+}
+
+// InsertRefreshToken stores a newly issued refresh token, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertRefreshToken(t data.RefreshToken) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = len(m.refreshTokens) + 1
+	t.CreatedAt = time.Now()
+	m.refreshTokens = append(m.refreshTokens, &t)
+
+	return t.ID, nil
+}
+
+// GetRefreshToken returns one refresh token by the hash of the signed token
+func (m *TestDBRepo) GetRefreshToken(tokenHash string) (*data.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.TokenHash == tokenHash {
+			found := *t
+			return &found, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// UseRefreshToken marks a refresh token as used. It returns false if the token
+// was already used or revoked, which means it is being replayed.
+func (m *TestDBRepo) UseRefreshToken(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.ID == id {
+			if !t.UsedAt.IsZero() || !t.RevokedAt.IsZero() {
+				return false, nil
+			}
+			t.UsedAt = time.Now()
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token that belongs to a token family
+func (m *TestDBRepo) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == familyID && t.RevokedAt.IsZero() {
+			t.RevokedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of a user, in every token family
+func (m *TestDBRepo) RevokeUserRefreshTokens(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.UserID == userID && t.RevokedAt.IsZero() {
+			t.RevokedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+// InsertPasswordReset stores a newly issued password reset token, and returns the ID of the newly inserted row
+func (m *TestDBRepo) InsertPasswordReset(r data.PasswordReset) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastResetID++
+	r.ID = m.lastResetID
+	r.CreatedAt = time.Now()
+	m.passwordResets = append(m.passwordResets, &r)
+
+	return r.ID, nil
+}
+
+// GetPasswordReset returns one password reset by the hash of its token
+func (m *TestDBRepo) GetPasswordReset(tokenHash string) (*data.PasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.passwordResets {
+		if r.TokenHash == tokenHash {
+			found := *r
+			return &found, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// UsePasswordReset marks a password reset as used. It returns false if the
+// reset was already used or has expired.
+func (m *TestDBRepo) UsePasswordReset(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.passwordResets {
+		if r.ID == id {
+			if !r.UsedAt.IsZero() || !r.ExpiresAt.After(time.Now()) {
+				return false, nil
+			}
+			r.UsedAt = time.Now()
+			return true, nil
+		}
+	}
 
-	return 1, nil
+	return false, nil
 }
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"webapp/pkg/data"
+)
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+	DefaultUserSort  = "last_name"
+)
+
+// UserSortFields are the fields users can be sorted by.
+var UserSortFields = []string{"id", "email", "first_name", "last_name", "created_at"}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions describes one page of a user listing. Pages are fetched with keyset
+// pagination: Cursor is the NextCursor of the previous page, and has to be used
+// with the same Sort and Desc.
+type ListOptions struct {
+	Limit         int
+	Cursor        string
+	Sort          string
+	Desc          bool
+	IsAdmin       *int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// UserPage is one page of a user listing.
+type UserPage struct {
+	Users      []*data.User
+	NextCursor string
+	Total      int
+	// Limit is the page size that was used, after Normalize
+	Limit int
+}
+
+// Normalize fills in the defaults and checks the options are valid.
+func (o ListOptions) Normalize() (ListOptions, error) {
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+
+	if o.Sort == "" {
+		o.Sort = DefaultUserSort
+	}
+
+	if !IsUserSortField(o.Sort) {
+		return o, fmt.Errorf("can not sort by %q", o.Sort)
+	}
+
+	if o.Cursor != "" {
+		if _, _, err := DecodeCursor(o.Cursor, o.Sort); err != nil {
+			return o, err
+		}
+	}
+
+	return o, nil
+}
+
+// IsUserSortField reports whether users can be sorted by field.
+func IsUserSortField(field string) bool {
+	for _, f := range UserSortFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// EncodeCursor returns the cursor pointing after user u, for a listing sorted by sort.
+func EncodeCursor(u *data.User, sort string) string {
+	c := cursor{Sort: sort, ID: u.ID}
+
+	switch sort {
+	case "id":
+		c.Value = strconv.Itoa(u.ID)
+	case "email":
+		c.Value = u.Email
+	case "first_name":
+		c.Value = u.FirstName
+	case "last_name":
+		c.Value = u.LastName
+	case "created_at":
+		c.Value = u.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the sort value and id stored in a cursor. The value is a
+// time.Time when sorting by created_at, an int when sorting by id, and a string
+// otherwise.
+func DecodeCursor(encoded, sort string) (interface{}, int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	switch sort {
+	case "id":
+		return c.ID, c.ID, nil
+	case "created_at":
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return t, c.ID, nil
+	}
+
+	return c.Value, c.ID, nil
+}
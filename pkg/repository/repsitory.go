@@ -8,11 +8,22 @@ import (
 type DatabaseRepo interface {
 	Connection() *sql.DB
 	AllUsers() ([]*data.User, error)
+	ListUsers(opts ListOptions) (*UserPage, error)
+	SearchUsers(query string, limit int) ([]*data.User, error)
 	GetUser(id int) (*data.User, error)
 	GetUserByEmail(email string) (*data.User, error)
 	UpdateUser(u data.User) error
 	DeleteUser(id int) error
 	InsertUser(user data.User) (int, error)
 	ResetPassword(id int, password string) error
+	VerifyUserEmail(id int, email string) (bool, error)
 	InsertUserImage(i data.UserImage) (int, error)
+	InsertRefreshToken(t data.RefreshToken) (int, error)
+	GetRefreshToken(tokenHash string) (*data.RefreshToken, error)
+	UseRefreshToken(id int) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+	InsertPasswordReset(r data.PasswordReset) (int, error)
+	GetPasswordReset(tokenHash string) (*data.PasswordReset, error)
+	UsePasswordReset(id int) (bool, error)
 }
@@ -0,0 +1,157 @@
+package sessionstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type memorySession struct {
+	data   []byte
+	expiry time.Time
+	info   *Session
+}
+
+// MemoryStore is a Store that lives in memory, it is only suitable for a single
+// instance, and sessions are lost on restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*memorySession
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*memorySession),
+	}
+}
+
+func (s *MemoryStore) Find(token string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[ID(token)]
+	if !ok || !time.Now().Before(session.expiry) {
+		return nil, false, nil
+	}
+
+	return session.data, true, nil
+}
+
+func (s *MemoryStore) Commit(token string, b []byte, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := ID(token)
+	if session, ok := s.sessions[id]; ok {
+		session.data, session.expiry = b, expiry
+		return nil
+	}
+
+	s.sessions[id] = &memorySession{data: b, expiry: expiry}
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, ID(token))
+
+	return nil
+}
+
+func (s *MemoryStore) Touch(token string, info Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[ID(token)]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	info.ID = ID(token)
+	info.CreatedAt = now
+	info.LastSeen = now
+
+	if session.info != nil && session.info.UserID == info.UserID {
+		info.CreatedAt = session.info.CreatedAt
+	}
+	session.info = &info
+
+	return nil
+}
+
+func (s *MemoryStore) List(userID int) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []Session
+	now := time.Now()
+
+	for _, session := range s.sessions {
+		if session.info != nil && session.info.UserID == userID && now.Before(session.expiry) {
+			info := *session.info
+			info.Expiry = session.expiry
+			sessions = append(sessions, info)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+func (s *MemoryStore) Revoke(userID int, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[id]; ok && session.info != nil && session.info.UserID == userID {
+		delete(s.sessions, id)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) RevokeOthers(userID int, keepID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if id != keepID && session.info != nil && session.info.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) RevokeAll(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.info != nil && session.info.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range s.sessions {
+		if !now.Before(session.expiry) {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package sessionstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	expiry := time.Now().Add(time.Hour)
+
+	_ = store.Commit("laptop", []byte("a"), expiry)
+	_ = store.Commit("phone", []byte("b"), expiry)
+	_ = store.Commit("other-user", []byte("c"), expiry)
+	_ = store.Commit("expired", []byte("d"), time.Now().Add(-time.Minute))
+
+	_ = store.Touch("laptop", Session{UserID: 1, IP: "10.0.0.1", UserAgent: "Firefox"})
+	time.Sleep(time.Millisecond)
+	_ = store.Touch("phone", Session{UserID: 1, IP: "10.0.0.2", UserAgent: "Safari"})
+	_ = store.Touch("other-user", Session{UserID: 2})
+	_ = store.Touch("expired", Session{UserID: 1})
+	_ = store.Touch("unknown", Session{UserID: 1})
+
+	if b, found, _ := store.Find("laptop"); !found || string(b) != "a" {
+		t.Errorf("expected to find session data; got %q, %v", b, found)
+	}
+
+	if _, found, _ := store.Find("expired"); found {
+		t.Error("found an expired session")
+	}
+
+	sessions, _ := store.List(1)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions of user 1; got %d", len(sessions))
+	}
+
+	if sessions[0].ID != ID("phone") || sessions[0].UserAgent != "Safari" {
+		t.Errorf("expected most recently seen session first; got %+v", sessions[0])
+	}
+
+	// users can only revoke their own sessions
+	_ = store.Revoke(2, ID("laptop"))
+	if _, found, _ := store.Find("laptop"); !found {
+		t.Error("session was revoked by another user")
+	}
+
+	_ = store.Revoke(1, ID("phone"))
+	if _, found, _ := store.Find("phone"); found {
+		t.Error("revoked session can still be found")
+	}
+
+	_ = store.Commit("tablet", []byte("e"), expiry)
+	_ = store.Touch("tablet", Session{UserID: 1})
+
+	_ = store.RevokeOthers(1, ID("laptop"))
+	sessions, _ = store.List(1)
+	if len(sessions) != 1 || sessions[0].ID != ID("laptop") {
+		t.Errorf("expected only the kept session to be left; got %d sessions", len(sessions))
+	}
+
+	if _, found, _ := store.Find("other-user"); !found {
+		t.Error("revoking other sessions removed a session of another user")
+	}
+
+	_ = store.Commit("phone", []byte("f"), expiry)
+	_ = store.Touch("phone", Session{UserID: 1})
+
+	_ = store.RevokeAll(1)
+	if sessions, _ := store.List(1); len(sessions) != 0 {
+		t.Errorf("expected no sessions after revoking all; got %d", len(sessions))
+	}
+
+	if _, found, _ := store.Find("other-user"); !found {
+		t.Error("revoking all sessions removed a session of another user")
+	}
+
+	// deleting a session, like scs does on logout, removes it from the index
+	_ = store.Commit("laptop", []byte("g"), expiry)
+	_ = store.Touch("laptop", Session{UserID: 1})
+	_ = store.Delete("laptop")
+	if sessions, _ := store.List(1); len(sessions) != 0 {
+		t.Errorf("expected no sessions after delete; got %d", len(sessions))
+	}
+
+	_ = store.DeleteExpired()
+	if len(store.sessions) != 1 {
+		t.Errorf("expected 1 session after cleanup; got %d", len(store.sessions))
+	}
+}
@@ -0,0 +1,184 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+// PostgresStore is a Store kept in the sessions and user_sessions tables, shared
+// by every instance. Rows of user_sessions are deleted with their session.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func (s *PostgresStore) Find(token string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select data from sessions where token_hash = $1 and expiry > $2`
+
+	var b []byte
+	err := s.DB.QueryRowContext(ctx, query, ID(token), time.Now()).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+func (s *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into sessions (token_hash, data, expiry) values ($1, $2, $3)
+		on conflict (token_hash) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := s.DB.ExecContext(ctx, stmt, ID(token), b, expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) Delete(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `delete from sessions where token_hash = $1`, ID(token))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) Touch(token string, info Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// a session that was revoked in the meantime must not come back
+	stmt := `insert into user_sessions (token_hash, user_id, ip, user_agent, created_at, last_seen_at)
+		select $1, $2, $3, $4, $5, $5 where exists (select 1 from sessions where token_hash = $1)
+		on conflict (token_hash) do update set
+			user_id = excluded.user_id,
+			ip = excluded.ip,
+			user_agent = excluded.user_agent,
+			last_seen_at = excluded.last_seen_at,
+			created_at = case when user_sessions.user_id = excluded.user_id
+				then user_sessions.created_at else excluded.created_at end`
+
+	_, err := s.DB.ExecContext(ctx, stmt, ID(token), info.UserID, info.IP, info.UserAgent, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) List(userID int) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		select
+			us.token_hash, us.user_id, us.ip, us.user_agent, us.created_at, us.last_seen_at, s.expiry
+		from
+			user_sessions us
+			join sessions s on (s.token_hash = us.token_hash)
+		where
+			us.user_id = $1 and s.expiry > $2
+		order by
+			us.last_seen_at desc`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.IP,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.LastSeen,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *PostgresStore) Revoke(userID int, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from sessions where token_hash = $1
+		and token_hash in (select token_hash from user_sessions where user_id = $2)`
+
+	_, err := s.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) RevokeOthers(userID int, keepID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from sessions where token_hash <> $1
+		and token_hash in (select token_hash from user_sessions where user_id = $2)`
+
+	_, err := s.DB.ExecContext(ctx, stmt, keepID, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) RevokeAll(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from sessions
+		where token_hash in (select token_hash from user_sessions where user_id = $1)`
+
+	_, err := s.DB.ExecContext(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `delete from sessions where expiry <= $1`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
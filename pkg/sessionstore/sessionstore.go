@@ -0,0 +1,77 @@
+// Package sessionstore keeps the sessions of the web app on the server, and an
+// index of them per user, so people can see where they are logged in and log
+// out other devices. Tokens are stored hashed, the hash is the id of a session.
+package sessionstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// Session describes one logged-in session of a user.
+type Session struct {
+	ID        string
+	UserID    int
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	Expiry    time.Time
+}
+
+// Store is a scs session store, which also knows who the sessions belong to.
+// Deleting a session, when it is destroyed or its token renewed, also removes
+// it from the index.
+type Store interface {
+	scs.Store
+
+	// Touch records that the session with token was used by s.UserID, from
+	// s.IP with s.UserAgent. Sessions that are not in the store are ignored.
+	Touch(token string, s Session) error
+	// List returns the active sessions of a user, most recently used first.
+	List(userID int) ([]Session, error)
+	// Revoke deletes the session with id, if it belongs to userID.
+	Revoke(userID int, id string) error
+	// RevokeOthers deletes every session of userID, except the one with keepID.
+	RevokeOthers(userID int, keepID string) error
+	// RevokeAll deletes every session of userID.
+	RevokeAll(userID int) error
+	// DeleteExpired removes sessions that have expired.
+	DeleteExpired() error
+}
+
+// ID returns the id a session token is stored under.
+func ID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// StartCleanup removes expired sessions from the store every interval, until
+// the returned stop function is called.
+func StartCleanup(store Store, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := store.DeleteExpired(); err != nil {
+					log.Println("error cleaning up sessions:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
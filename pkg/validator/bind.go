@@ -0,0 +1,104 @@
+package validator
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Bind copies the values of a form post into dst, a pointer to a struct.
+// Fields are matched by their form tag, or else by the name errors are
+// reported under. Strings, whole numbers, booleans and string slices are
+// supported, pointers to them are only set when the value was sent. Values
+// that can't be converted are returned as field errors.
+func Bind(values url.Values, dst any) Errors {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: Bind needs a pointer to a struct, got %T", dst))
+	}
+	rv = rv.Elem()
+
+	errs := Errors{}
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("form") == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get("form"), ",")
+		if name == "" {
+			name = FieldName(sf)
+		}
+
+		sent, ok := values[name]
+		if !ok {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			fv.Set(reflect.New(fv.Type().Elem()))
+			fv = fv.Elem()
+		}
+
+		if message := setValue(fv, sent); message != "" {
+			errs.Add(FieldName(sf), message)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// setValue converts the values sent for one field, and stores them in fv.
+func setValue(fv reflect.Value, sent []string) string {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String {
+		fv.Set(reflect.ValueOf(append([]string{}, sent...)).Convert(fv.Type()))
+		return ""
+	}
+
+	value := ""
+	if len(sent) > 0 {
+		value = sent[0]
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if strings.TrimSpace(value) == "" {
+			fv.SetInt(0)
+			return ""
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, fv.Type().Bits())
+		if err != nil {
+			return "This field must be a whole number"
+		}
+		fv.SetInt(n)
+
+	case reflect.Bool:
+		// checkboxes send "on" when they are ticked, and nothing otherwise
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "", "0", "false", "off":
+			fv.SetBool(false)
+		case "1", "true", "on", "yes":
+			fv.SetBool(true)
+		default:
+			return "This field must be yes or no"
+		}
+
+	default:
+		panic(fmt.Sprintf("validator: Bind can't set a %s", fv.Type()))
+	}
+
+	return ""
+}
@@ -0,0 +1,304 @@
+// Package validator checks structs against the rules in their validate tags,
+// like `validate:"required,email,max=255"`. It is used for decoded JSON bodies
+// of the api and for form posts bound to structs, so both report the same
+// errors for the same mistakes.
+//
+// The rules are:
+//
+//	required      the value is not empty, strings are trimmed first
+//	email         a single, plain email address
+//	min=n, max=n  the length of strings, or the value of numbers
+//	oneof=a b c   one of the values, separated by spaces
+//	password=n    at least n characters long, with letters and digits
+//	eqfield=Name  equal to the field Name of the same struct
+//	int           a string holding a whole number
+//	url           an absolute http or https url
+//	date=layout   a string holding a date in layout, 2006-01-02 by default
+//
+// Every rule but required accepts empty values, so optional fields only
+// have to be checked when they are filled in. Nil pointers are fields that
+// were not sent, and are not checked at all; the rules of a pointer apply to
+// the value it points to.
+package validator
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Errors maps field names to their error messages. The names are those of the
+// json tag of a field, or its form tag, so they match what the client sent.
+type Errors map[string][]string
+
+// Add adds an error message to field.
+func (e Errors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Get returns the first error of field, or an empty string.
+func (e Errors) Get(field string) string {
+	if len(e[field]) == 0 {
+		return ""
+	}
+
+	return e[field][0]
+}
+
+// All returns every error of field.
+func (e Errors) All(field string) []string {
+	return e[field]
+}
+
+// Has reports whether field has an error.
+func (e Errors) Has(field string) bool {
+	return len(e[field]) > 0
+}
+
+// Error lists the fields with errors, so Errors can be returned as an error.
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+// Validator checks structs. Messages replaces the default error messages, by
+// rule like "required", or by field and rule like "email.required". Translate,
+// when set, translates the messages, which can hold fmt verbs.
+type Validator struct {
+	Messages  map[string]string
+	Translate func(format string, args ...any) string
+}
+
+// Struct checks v, a struct or a pointer to one, with the default messages.
+func Struct(v any) Errors {
+	return Validator{}.Struct(v)
+}
+
+// Struct checks v, a struct or a pointer to one. It returns nil when every
+// field is valid.
+func (val Validator) Struct(v any) Errors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: %T is not a struct", v))
+	}
+
+	errs := Errors{}
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		name := FieldName(sf)
+		for _, rule := range strings.Split(tag, ",") {
+			rule, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+			if format, args := val.check(rv, fv, rule, param); format != "" {
+				errs.Add(name, val.message(name, rule, format, args))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// FieldName returns the name field errors are reported under: the name of the
+// json tag, else the form tag, else the name of the field in lower case.
+func FieldName(sf reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		if name, _, _ := strings.Cut(sf.Tag.Get(key), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return strings.ToLower(sf.Name)
+}
+
+// message returns the message of rule for field, from Messages if it is
+// there, translated and formatted with args.
+func (val Validator) message(field, rule, format string, args []any) string {
+	if m, ok := val.Messages[field+"."+rule]; ok {
+		format = m
+	} else if m, ok := val.Messages[rule]; ok {
+		format = m
+	}
+
+	if val.Translate != nil {
+		return val.Translate(format, args...)
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, args...)
+}
+
+// check applies one rule to the value of a field. When it fails, it returns
+// the default error message, a format for args.
+func (val Validator) check(parent, fv reflect.Value, rule, param string) (string, []any) {
+	if rule == "required" {
+		if isEmpty(fv) {
+			return "This field is required", nil
+		}
+		return "", nil
+	}
+
+	if isEmpty(fv) {
+		return "", nil
+	}
+
+	switch rule {
+	case "email":
+		value := strings.TrimSpace(fv.String())
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return "Invalid email address", nil
+		}
+
+	case "min", "max":
+		limit, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("validator: %s needs a number, got %q", rule, param))
+		}
+
+		size, isLength := measure(fv)
+		switch {
+		case rule == "min" && size < limit && isLength:
+			return "This field must be at least %d characters long", []any{limit}
+		case rule == "min" && size < limit:
+			return "This field must be at least %d", []any{limit}
+		case rule == "max" && size > limit && isLength:
+			return "This field must be at most %d characters long", []any{limit}
+		case rule == "max" && size > limit:
+			return "This field must be at most %d", []any{limit}
+		}
+
+	case "oneof":
+		value := fmt.Sprint(fv.Interface())
+		options := strings.Fields(param)
+		for _, o := range options {
+			if value == o {
+				return "", nil
+			}
+		}
+		return "This field must be one of: %s", []any{strings.Join(options, ", ")}
+
+	case "password":
+		minLength, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("validator: password needs a length, got %q", param))
+		}
+
+		if !IsStrongPassword(fv.String(), minLength) {
+			return "Password must be at least %d characters long and contain letters and digits", []any{minLength}
+		}
+
+	case "eqfield":
+		other := parent.FieldByName(param)
+		if !other.IsValid() {
+			panic(fmt.Sprintf("validator: eqfield %s does not exist", param))
+		}
+
+		other = reflect.Indirect(other)
+		if !other.IsValid() || other.Interface() != fv.Interface() {
+			return "The values do not match", nil
+		}
+
+	case "int":
+		if _, err := strconv.Atoi(strings.TrimSpace(fv.String())); err != nil {
+			return "This field must be a whole number", nil
+		}
+
+	case "url":
+		u, err := url.ParseRequestURI(strings.TrimSpace(fv.String()))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "This field must be a http or https url", nil
+		}
+
+	case "date":
+		layout := param
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+
+		if _, err := time.Parse(layout, strings.TrimSpace(fv.String())); err != nil {
+			return "This field must be a date like %s", []any{layout}
+		}
+
+	default:
+		panic(fmt.Sprintf("validator: unknown rule %q", rule))
+	}
+
+	return "", nil
+}
+
+// IsStrongPassword reports whether password is at least minLength characters
+// long, and has both letters and digits.
+func IsStrongPassword(password string, minLength int) bool {
+	var hasLetter, hasDigit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+
+	return len([]rune(password)) >= minLength && hasLetter && hasDigit
+}
+
+// isEmpty reports whether v is the zero value, with strings trimmed first.
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+
+	return v.IsZero()
+}
+
+// measure returns the length of strings, slices and maps, or the value of
+// numbers. isLength tells which one it is.
+func measure(v reflect.Value) (size int, isLength bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return len([]rune(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return int(v.Float()), false
+	}
+
+	panic(fmt.Sprintf("validator: min and max don't work on %s", v.Kind()))
+}
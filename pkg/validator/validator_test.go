@@ -0,0 +1,148 @@
+package validator
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type signup struct {
+	Name     string  `json:"name" validate:"required,max=10"`
+	Email    string  `json:"email" validate:"required,email"`
+	Password string  `json:"password" validate:"required,password=8"`
+	Confirm  string  `json:"confirm" validate:"eqfield=Password"`
+	Age      int     `json:"age" validate:"min=18,max=130"`
+	Role     string  `json:"role" validate:"oneof=user admin"`
+	Website  string  `json:"website" validate:"url"`
+	Born     string  `json:"born" validate:"date"`
+	Count    string  `form:"count" validate:"int"`
+	Nickname *string `json:"nickname" validate:"required,min=2"`
+	Notes    string
+}
+
+func validSignup() signup {
+	return signup{
+		Name:     "Jane",
+		Email:    "jane@example.com",
+		Password: "secret123",
+		Confirm:  "secret123",
+	}
+}
+
+func TestStruct(t *testing.T) {
+	empty, short := "", "j"
+
+	var tests = []struct {
+		name          string
+		change        func(s *signup)
+		expectedField string
+	}{
+		{"valid", func(s *signup) {}, ""},
+		{"valid-optional-fields", func(s *signup) {
+			s.Age, s.Role, s.Website, s.Born, s.Count = 30, "admin", "https://example.com", "1990-05-17", "12"
+		}, ""},
+		{"missing-name", func(s *signup) { s.Name = "  " }, "name"},
+		{"long-name", func(s *signup) { s.Name = "Janet Jacqueline" }, "name"},
+		{"invalid-email", func(s *signup) { s.Email = "Jane <jane@example.com>" }, "email"},
+		{"weak-password", func(s *signup) { s.Password, s.Confirm = "secretsecret", "secretsecret" }, "password"},
+		{"passwords-differ", func(s *signup) { s.Confirm = "secret124" }, "confirm"},
+		{"too-young", func(s *signup) { s.Age = 12 }, "age"},
+		{"unknown-role", func(s *signup) { s.Role = "root" }, "role"},
+		{"relative-url", func(s *signup) { s.Website = "/home" }, "website"},
+		{"invalid-date", func(s *signup) { s.Born = "17.05.1990" }, "born"},
+		{"not-a-number", func(s *signup) { s.Count = "twelve" }, "count"},
+		{"empty-pointer", func(s *signup) { s.Nickname = &empty }, "nickname"},
+		{"short-pointer", func(s *signup) { s.Nickname = &short }, "nickname"},
+	}
+
+	for _, e := range tests {
+		s := validSignup()
+		e.change(&s)
+
+		errs := Struct(&s)
+
+		if e.expectedField == "" {
+			if errs != nil {
+				t.Errorf("%s: expected no errors; got %v", e.name, errs)
+			}
+			continue
+		}
+
+		if len(errs) != 1 || !errs.Has(e.expectedField) {
+			t.Errorf("%s: expected an error on %s only; got %v", e.name, e.expectedField, errs)
+		}
+	}
+}
+
+func TestStruct_messages(t *testing.T) {
+	errs := Struct(signup{})
+
+	if got := errs.Get("name"); got != "This field is required" {
+		t.Errorf("wrong default message: %q", got)
+	}
+
+	if errs.Has("confirm") || errs.Has("role") {
+		t.Errorf("empty optional fields should not have errors: %v", errs)
+	}
+
+	v := Validator{Messages: map[string]string{
+		"required":       "Please fill this in",
+		"email.required": "We need your email address",
+	}}
+	errs = v.Struct(signup{})
+
+	if got := errs.Get("name"); got != "Please fill this in" {
+		t.Errorf("expected the message of the rule; got %q", got)
+	}
+
+	if got := errs.Get("email"); got != "We need your email address" {
+		t.Errorf("expected the message of the field; got %q", got)
+	}
+
+	if !strings.Contains(errs.Error(), "email, name, password") {
+		t.Errorf("wrong error text: %s", errs.Error())
+	}
+}
+
+func TestBind(t *testing.T) {
+	type form struct {
+		Name     string   `form:"name"`
+		Age      int      `form:"age"`
+		Admin    bool     `form:"is_admin"`
+		Tags     []string `form:"tag"`
+		Nickname *string  `form:"nickname"`
+		Email    *string  `json:"email"`
+		Ignored  string   `form:"-"`
+	}
+
+	var f form
+	errs := Bind(url.Values{
+		"name":     {"Jane"},
+		"age":      {" 42 "},
+		"is_admin": {"on"},
+		"tag":      {"a", "b"},
+		"email":    {"jane@example.com"},
+		"Ignored":  {"x"},
+	}, &f)
+
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	if f.Name != "Jane" || f.Age != 42 || !f.Admin || len(f.Tags) != 2 || f.Ignored != "" {
+		t.Errorf("wrong values: %+v", f)
+	}
+
+	if f.Nickname != nil {
+		t.Error("expected fields that were not sent to stay nil")
+	}
+
+	if f.Email == nil || *f.Email != "jane@example.com" {
+		t.Error("expected the json name to be used without a form tag")
+	}
+
+	errs = Bind(url.Values{"age": {"old"}, "is_admin": {"maybe"}}, &f)
+	if !errs.Has("age") || !errs.Has("is_admin") {
+		t.Errorf("expected conversion errors; got %v", errs)
+	}
+}
@@ -0,0 +1,96 @@
+// Package verification signs the links that confirm email addresses. Nothing
+// is stored: a token carries the user id, the email address and its expiry,
+// and is signed with a key shared by the web application, which confirms the
+// links, and the api, which sends them as well.
+package verification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/mailer"
+)
+
+// TTL is how long a verification link can be used.
+const TTL = 48 * time.Hour
+
+// ErrInvalid is returned for tokens that are forged, garbled or expired.
+var ErrInvalid = errors.New("invalid or expired verification link")
+
+// Sign returns a token confirming that the user with id owns email, valid
+// until expires.
+func Sign(key []byte, id int, email string, expires time.Time) string {
+	payload := fmt.Sprintf("%d|%d|%s", id, expires.Unix(), email)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Parse checks the signature and expiry of token, and returns the user id and
+// email address it confirms.
+func Parse(key []byte, token string) (int, string, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", ErrInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return 0, "", ErrInvalid
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return 0, "", ErrInvalid
+	}
+
+	parts := strings.SplitN(string(payload), "|", 3)
+	if len(parts) != 3 {
+		return 0, "", ErrInvalid
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", ErrInvalid
+	}
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, "", ErrInvalid
+	}
+
+	return id, parts[2], nil
+}
+
+// Message returns the email asking user to confirm their email address, with
+// a link to the web application at baseURL. It is translated by p.
+func Message(p *i18n.Printer, key []byte, baseURL string, user *data.User) mailer.Message {
+	token := Sign(key, user.ID, user.Email, time.Now().Add(TTL))
+	link := fmt.Sprintf("%s/verify-email/confirm?token=%s", baseURL, url.QueryEscape(token))
+
+	return mailer.Message{
+		To:      user.Email,
+		Subject: p.Sprintf("Confirm your email address"),
+		Body: fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s\n",
+			p.Sprintf("Hi %s,", user.FirstName),
+			p.Sprintf("Please confirm your email address by opening this link within the next 48 hours:"),
+			link,
+			p.Sprintf("If you did not create an account, you can ignore this email.")),
+	}
+}
@@ -0,0 +1,71 @@
+package verification
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+)
+
+var key = []byte("test-verification-key")
+
+func TestParse(t *testing.T) {
+	valid := Sign(key, 3, "john@example.com", time.Now().Add(time.Hour))
+	expired := Sign(key, 3, "john@example.com", time.Now().Add(-time.Minute))
+
+	payload, _, _ := strings.Cut(valid, ".")
+	otherSigned := Sign(key, 1, "admin@example.com", time.Now().Add(time.Hour))
+	_, otherSignature, _ := strings.Cut(otherSigned, ".")
+
+	var tests = []struct {
+		name          string
+		key           []byte
+		token         string
+		errorExpected bool
+	}{
+		{"valid", key, valid, false},
+		{"expired", key, expired, true},
+		{"swapped-signature", key, payload + "." + otherSignature, true},
+		{"other-key", []byte("other-key"), valid, true},
+		{"no-signature", key, payload, true},
+		{"garbage", key, "abc.def", true},
+		{"empty", key, "", true},
+	}
+
+	for _, e := range tests {
+		id, email, err := Parse(e.key, e.token)
+
+		if err != nil && !e.errorExpected {
+			t.Errorf("%s: did not expect error; got %s", e.name, err)
+		}
+
+		if err == nil && e.errorExpected {
+			t.Errorf("%s: expected error; got nothing", e.name)
+		}
+
+		if !e.errorExpected && (id != 3 || email != "john@example.com") {
+			t.Errorf("%s: got wrong data back: %d %s", e.name, id, email)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	user := &data.User{ID: 3, FirstName: "John", Email: "john@example.com"}
+
+	msg := Message(nil, key, "https://example.com", user)
+	if msg.To != user.Email {
+		t.Errorf("expected mail to %s; got %s", user.Email, msg.To)
+	}
+
+	match := regexp.MustCompile(`https://example\.com/verify-email/confirm\?token=(\S+)`).FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no verification link in mail: %s", msg.Body)
+	}
+
+	token, _ := url.QueryUnescape(match[1])
+	if id, email, err := Parse(key, token); err != nil || id != 3 || email != user.Email {
+		t.Errorf("link does not confirm the address of the user: %d %s %v", id, email, err)
+	}
+}
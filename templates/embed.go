@@ -0,0 +1,10 @@
+// Package templates embeds the html templates of the web app into the binary.
+package templates
+
+import "embed"
+
+// FS holds every template: pages (*.page.gohtml), layouts (*.layout.gohtml)
+// and partials (*.partial.gohtml).
+//
+//go:embed *.gohtml
+var FS embed.FS